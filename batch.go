@@ -0,0 +1,217 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultBatchSize is the number of recipients sent in each request by SendBulk
+const DefaultBatchSize = 500
+
+// BulkOptions controls how SendBulk splits and sends a message
+type BulkOptions struct {
+	// BatchSize is the maximum number of recipients per request
+	BatchSize int
+	// Concurrency is the number of requests sent in parallel, at least 1
+	Concurrency int
+}
+
+// RecipientResult is the outcome of sending to one recipient
+type RecipientResult struct {
+	Recipient  string
+	TrackingID string
+	Err        error
+}
+
+// BulkResult holds the outcome for every recipient of a bulk send
+type BulkResult struct {
+	// Results are in the same order as the recipients of the destination,
+	// a recipient listed twice has two results
+	Results []*RecipientResult
+	Sent    int
+	Failed  int
+}
+
+// SendBulk sends a message to a large number of recipients by splitting
+// them into several requests. Failed requests do not stop the others; the
+// error of each recipient is found in the result. No more requests are
+// started once the context is done.
+func (c *Client) SendBulk(ctx context.Context, message Message, opts *BulkOptions) (*BulkResult, error) {
+	if opts == nil {
+		opts = &BulkOptions{}
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	dest := c.resolveDestination(message)
+	if dest == nil || len(dest.Recipients) == 0 {
+		return nil, fmt.Errorf("message has no destination set")
+	}
+
+	result := &BulkResult{Results: make([]*RecipientResult, len(dest.Recipients))}
+
+	// invalid recipients are reported without failing the rest of their batch
+	valid := []int{}
+	for i, recipient := range dest.Recipients {
+		if _, err := ParsePhoneNumber(recipient, dest.DefaultCountryCode); err != nil {
+			result.set(i, recipient, "", &InvalidRecipientsError{
+				Recipients: []*InvalidRecipient{{Recipient: recipient, Err: err}},
+			})
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	batches := []Message{}
+	chunks := [][]int{}
+	for start := 0; start < len(valid); start += batchSize {
+		end := start + batchSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		chunk := valid[start:end]
+
+		recipients := []string{}
+		for _, i := range chunk {
+			recipients = append(recipients, dest.Recipients[i])
+		}
+		batch, err := withDestination(message, &Destination{
+			Recipients:         recipients,
+			DefaultCountryCode: dest.DefaultCountryCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+		chunks = append(chunks, chunk)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				response, err := c.SendMessageContext(ctx, batches[i])
+
+				mu.Lock()
+				result.add(dest.Recipients, chunks[i], response, err)
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for i := range batches {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			mu.Lock()
+			for j := i; j < len(batches); j++ {
+				result.add(dest.Recipients, chunks[j], nil, ctx.Err())
+			}
+			mu.Unlock()
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result, nil
+}
+
+// add records the outcome of a request to the recipients at the indexes in
+// chunk. Tracking ids are returned in the same order as the recipients.
+func (r *BulkResult) add(recipients []string, chunk []int, response *Response, err error) {
+	for n, i := range chunk {
+		recipient := recipients[i]
+		if err != nil {
+			r.set(i, recipient, "", err)
+		} else if n < len(response.TrackingIDs) {
+			r.set(i, recipient, response.TrackingIDs[n], nil)
+		} else {
+			r.set(i, recipient, "", fmt.Errorf("no tracking id returned for %s", recipient))
+		}
+	}
+}
+
+// set records the outcome for the recipient at index i
+func (r *BulkResult) set(i int, recipient, trackingID string, err error) {
+	if err == nil {
+		r.Sent++
+	} else {
+		r.Failed++
+	}
+	r.Results[i] = &RecipientResult{
+		Recipient:  recipient,
+		TrackingID: trackingID,
+		Err:        err,
+	}
+}
+
+// destinationMessage is implemented by messages embedding *Destination
+type destinationMessage interface {
+	destination() *Destination
+}
+
+func (b *Destination) destination() *Destination { return b }
+
+// messageDestination returns the destination of a message, or nil
+func messageDestination(message Message) *Destination {
+	if m, ok := message.(destinationMessage); ok {
+		return m.destination()
+	}
+	return nil
+}
+
+// withDestination returns a copy of the message with a new destination
+func withDestination(message Message, dest *Destination) (Message, error) {
+	switch m := message.(type) {
+	case *TextMessage:
+		c := *m
+		c.Destination = dest
+		return &c, nil
+	case *FlashMessage:
+		c := *m
+		c.Destination = dest
+		return &c, nil
+	case *UnicodeMessage:
+		c := *m
+		c.Destination = dest
+		return &c, nil
+	case *BinaryMessage:
+		c := *m
+		c.Destination = dest
+		return &c, nil
+	case *WAPPushMessage:
+		c := *m
+		c.Destination = dest
+		return &c, nil
+	}
+	return nil, fmt.Errorf("can not change destination of %s message", message.Type())
+}
@@ -0,0 +1,190 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+// -------------------------------------------------------------
+// Bulk sending
+
+func (suite *CellsyntSuite) Test_Client_SendBulk(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703112244", "0046703112255"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: aaaa,bbbb",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(body, Matches, ".*destination=0046703112233%2C0046703112244&.*")
+		},
+	})
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Invalid destination",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(body, Matches, ".*destination=0046703112255&.*")
+		},
+	})
+
+	result, err := suite.client.SendBulk(context.Background(), r, &BulkOptions{BatchSize: 2})
+
+	c.Assert(err, IsNil)
+	c.Assert(result.Sent, Equals, 2)
+	c.Assert(result.Failed, Equals, 1)
+	c.Assert(result.Results, HasLen, 3)
+	c.Assert(result.Results[0], DeepEquals, &RecipientResult{Recipient: "0046703112233", TrackingID: "aaaa"})
+	c.Assert(result.Results[1], DeepEquals, &RecipientResult{Recipient: "0046703112244", TrackingID: "bbbb"})
+	c.Assert(result.Results[2].Recipient, Equals, "0046703112255")
+	c.Assert(result.Results[2].Err, ErrorMatches, "Invalid destination")
+
+	// the original message is left untouched
+	c.Assert(r.Recipients, HasLen, 3)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendBulk_Concurrent(c *C) {
+	recipients := []string{}
+	for i := 0; i < 10; i++ {
+		recipients = append(recipients, "004670311220"+string(rune('0'+i)))
+		suite.server.AddResponse(&t.MockResponse{
+			Method: "POST",
+			Code:   200,
+			Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		})
+	}
+
+	r := &TextMessage{
+		Destination: &Destination{Recipients: recipients},
+		Text:        "test",
+	}
+
+	result, err := suite.client.SendBulk(context.Background(), r, &BulkOptions{
+		BatchSize:   1,
+		Concurrency: 4,
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(result.Sent, Equals, 10)
+	c.Assert(result.Results, HasLen, 10)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendBulk_MissingTrackingID(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703112244"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: aaaa",
+	})
+
+	result, err := suite.client.SendBulk(context.Background(), r, nil)
+
+	c.Assert(err, IsNil)
+	c.Assert(result.Sent, Equals, 1)
+	c.Assert(result.Results[1].Err, ErrorMatches, "no tracking id returned for 0046703112244")
+}
+
+func (suite *CellsyntSuite) Test_Client_SendBulk_InvalidRecipient(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "555-123-45"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: aaaa",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(body, Matches, ".*destination=0046703112233&.*")
+		},
+	})
+
+	result, err := suite.client.SendBulk(context.Background(), r, nil)
+
+	c.Assert(err, IsNil)
+	c.Assert(result.Sent, Equals, 1)
+	c.Assert(result.Failed, Equals, 1)
+	c.Assert(result.Results[1].Recipient, Equals, "555-123-45")
+	c.Assert(result.Results[1].Err, ErrorMatches, `invalid recipients: 555-123-45 \(national number has no country code\)`)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendBulk_Duplicates(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: aaaa,bbbb",
+	})
+
+	result, err := suite.client.SendBulk(context.Background(), r, nil)
+
+	c.Assert(err, IsNil)
+	c.Assert(result.Sent, Equals, 2)
+	c.Assert(result.Results, HasLen, 2)
+	c.Assert(result.Results[0].TrackingID, Equals, "aaaa")
+	c.Assert(result.Results[1].TrackingID, Equals, "bbbb")
+}
+
+func (suite *CellsyntSuite) Test_Client_SendBulk_Canceled(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703112244"},
+		},
+		Text: "test",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// no request is made to the mock server
+	result, err := suite.client.SendBulk(ctx, r, &BulkOptions{BatchSize: 1})
+
+	c.Assert(err, IsNil)
+	c.Assert(result.Failed, Equals, 2)
+	for _, res := range result.Results {
+		c.Assert(errors.Is(res.Err, context.Canceled), Equals, true)
+	}
+}
+
+func (suite *CellsyntSuite) Test_Client_SendBulk_NoDestination(c *C) {
+	_, err := suite.client.SendBulk(context.Background(), &TextMessage{Text: "test"}, nil)
+	c.Assert(err, ErrorMatches, "message has no destination set")
+}
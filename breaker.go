@@ -0,0 +1,208 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed lets all requests through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails all requests without sending them
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a few probe requests through to test the gateway
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// Default values used for unset CircuitBreaker fields
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// ErrCircuitOpen is matched by errors returned while the circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned instead of sending a request while the
+// circuit is open
+type CircuitOpenError struct {
+	// RetryAfter is the time until a probe request is let through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open, retry in %s", e.RetryAfter)
+}
+
+// Unwrap returns ErrCircuitOpen
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitBreaker stops requests to the gateway after a number of
+// consecutive failures. Only transport errors, timeouts and 5xx responses
+// count as failures; errors reported by the gateway do not.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before probing
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of successful probes closing the circuit
+	HalfOpenRequests int
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+// NewCircuitBreaker returns a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		HalfOpenRequests: 1,
+	}
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.FailureThreshold > 0 {
+		return b.FailureThreshold
+	}
+	return DefaultFailureThreshold
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout > 0 {
+		return b.OpenTimeout
+	}
+	return DefaultOpenTimeout
+}
+
+func (b *CircuitBreaker) halfOpenRequests() int {
+	if b.HalfOpenRequests > 0 {
+		return b.HalfOpenRequests
+	}
+	return 1
+}
+
+// State returns the current state, for use in health checks
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+	return b.state
+}
+
+// advance moves an open circuit to half-open when the timeout has passed
+func (b *CircuitBreaker) advance(now time.Time) {
+	if b.state == "" {
+		b.state = CircuitClosed
+	}
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.openTimeout() {
+		b.state = CircuitHalfOpen
+		b.probes = 0
+		b.successes = 0
+	}
+}
+
+func (b *CircuitBreaker) open(now time.Time) {
+	b.state = CircuitOpen
+	b.openedAt = now
+}
+
+// allow returns an error if a request may not be sent. Probe is set if the
+// request is a half-open probe.
+func (b *CircuitBreaker) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+
+	switch b.state {
+	case CircuitOpen:
+		return false, &CircuitOpenError{RetryAfter: b.openTimeout() - now.Sub(b.openedAt)}
+	case CircuitHalfOpen:
+		if b.probes >= b.halfOpenRequests() {
+			// the circuit opens again for the timeout if the probes fail
+			return false, &CircuitOpenError{RetryAfter: b.openTimeout()}
+		}
+		b.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record updates the state with the outcome of an allowed request
+func (b *CircuitBreaker) record(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+
+	failure := breakerFailure(err)
+	neutral := err != nil && !failure && (errors.Is(err, context.Canceled) || errors.Is(err, ErrRateLimited))
+
+	switch b.state {
+	case CircuitClosed:
+		if failure {
+			b.failures++
+			if b.failures >= b.threshold() {
+				b.open(time.Now())
+			}
+		} else if !neutral {
+			b.failures = 0
+		}
+
+	case CircuitHalfOpen:
+		if !probe {
+			return
+		}
+		b.probes--
+		if failure {
+			b.open(time.Now())
+		} else if !neutral {
+			b.successes++
+			if b.successes >= b.halfOpenRequests() {
+				b.state = CircuitClosed
+				b.failures = 0
+			}
+		}
+	}
+}
+
+// breakerFailure reports if an error means that the gateway is unhealthy
+func breakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return retryClass(err)&(RetryConnection|RetryNetwork|RetryServer) != 0
+}
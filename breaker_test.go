@@ -0,0 +1,234 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&BreakerSuite{})
+
+type BreakerSuite struct{}
+
+var (
+	errTestServer  = &Error{Code: ErrorCodeServer}
+	errTestGateway = &Error{Code: ErrorCodeInvalidDestination}
+)
+
+// -------------------------------------------------------------
+// State
+
+func (suite *BreakerSuite) Test_CircuitBreaker_Opens(c *C) {
+	b := NewCircuitBreaker(2, time.Minute)
+	c.Assert(b.State(), Equals, CircuitClosed)
+
+	b.record(false, errTestServer)
+	c.Assert(b.State(), Equals, CircuitClosed)
+	b.record(false, errTestServer)
+	c.Assert(b.State(), Equals, CircuitOpen)
+
+	_, err := b.allow()
+	c.Assert(errors.Is(err, ErrCircuitOpen), Equals, true)
+
+	var openErr *CircuitOpenError
+	c.Assert(errors.As(err, &openErr), Equals, true)
+	c.Assert(openErr.RetryAfter > 59*time.Second, Equals, true)
+}
+
+func (suite *BreakerSuite) Test_CircuitBreaker_ConsecutiveFailures(c *C) {
+	b := NewCircuitBreaker(2, time.Minute)
+
+	b.record(false, errTestServer)
+	b.record(false, nil)
+	b.record(false, errTestServer)
+	c.Assert(b.State(), Equals, CircuitClosed)
+
+	// errors from the gateway mean it is working
+	b.record(false, errTestGateway)
+	b.record(false, errTestServer)
+	c.Assert(b.State(), Equals, CircuitClosed)
+
+	// canceled requests are not counted either way
+	b.record(false, context.Canceled)
+	b.record(false, errTestServer)
+	c.Assert(b.State(), Equals, CircuitOpen)
+}
+
+func (suite *BreakerSuite) Test_CircuitBreaker_HalfOpen(c *C) {
+	b := NewCircuitBreaker(1, 10*time.Millisecond)
+	b.record(false, context.DeadlineExceeded)
+	c.Assert(b.State(), Equals, CircuitOpen)
+
+	time.Sleep(15 * time.Millisecond)
+	c.Assert(b.State(), Equals, CircuitHalfOpen)
+
+	probe, err := b.allow()
+	c.Assert(err, IsNil)
+	c.Assert(probe, Equals, true)
+
+	// only one probe at a time
+	_, err = b.allow()
+	c.Assert(errors.Is(err, ErrCircuitOpen), Equals, true)
+
+	var openErr *CircuitOpenError
+	c.Assert(errors.As(err, &openErr), Equals, true)
+	c.Assert(openErr.RetryAfter, Equals, 10*time.Millisecond)
+
+	b.record(probe, nil)
+	c.Assert(b.State(), Equals, CircuitClosed)
+}
+
+func (suite *BreakerSuite) Test_CircuitBreaker_ProbeFails(c *C) {
+	b := NewCircuitBreaker(1, 10*time.Millisecond)
+	b.record(false, errTestServer)
+
+	time.Sleep(15 * time.Millisecond)
+	probe, err := b.allow()
+	c.Assert(err, IsNil)
+
+	// requests started before the circuit opened are ignored
+	b.record(false, nil)
+	c.Assert(b.State(), Equals, CircuitHalfOpen)
+
+	b.record(probe, errTestServer)
+	c.Assert(b.State(), Equals, CircuitOpen)
+}
+
+// -------------------------------------------------------------
+// Client
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_CircuitBreaker(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	for i := 0; i < 2; i++ {
+		suite.server.AddResponse(&t.MockResponse{
+			Method: "POST",
+			Code:   503,
+			Body:   "Service Unavailable",
+		})
+	}
+
+	suite.client.Breaker = NewCircuitBreaker(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, err := suite.client.SendMessage(r)
+		c.Assert(errors.Is(err, ErrServer), Equals, true)
+	}
+	c.Assert(suite.client.Breaker.State(), Equals, CircuitOpen)
+
+	// fails without a request to the server
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrCircuitOpen), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_CircuitBreakerRateLimitWait(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	suite.client.RateLimiter = NewRateLimiter(1, 1)
+	suite.client.Breaker = NewCircuitBreaker(2, time.Minute)
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+
+	// deadlines expiring while waiting for the rate limiter are not gateway failures
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := suite.client.SendMessageContext(ctx, r)
+		cancel()
+		c.Assert(errors.Is(err, context.DeadlineExceeded), Equals, true)
+	}
+	c.Assert(suite.client.Breaker.State(), Equals, CircuitClosed)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_CircuitBreakerRetry(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	for i := 0; i < 2; i++ {
+		suite.server.AddResponse(&t.MockResponse{
+			Method: "POST",
+			Code:   503,
+			Body:   "Service Unavailable",
+		})
+	}
+
+	suite.client.Breaker = NewCircuitBreaker(2, time.Minute)
+	suite.client.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}
+
+	// the gateway error is returned, not the breaker opened by it
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrServer), Equals, true)
+	c.Assert(suite.client.Breaker.State(), Equals, CircuitOpen)
+
+	// an open breaker is not retried
+	start := time.Now()
+	_, err = suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrCircuitOpen), Equals, true)
+	c.Assert(time.Since(start) < 10*time.Millisecond, Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_CircuitBreakerStopsRetry(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+
+	suite.client.Breaker = NewCircuitBreaker(1, time.Minute)
+	suite.client.Retry = &RetryPolicy{MaxAttempts: 6, InitialBackoff: 50 * time.Millisecond}
+
+	// the first retry finds the breaker open and gives up
+	start := time.Now()
+	_, err := suite.client.SendMessage(r)
+	c.Assert(time.Since(start) < 100*time.Millisecond, Equals, true)
+	c.Assert(errors.Is(err, ErrServer), Equals, true)
+
+	var sendErr *SendError
+	c.Assert(errors.As(err, &sendErr), Equals, true)
+	c.Assert(sendErr.Attempts, Equals, 1)
+}
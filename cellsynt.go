@@ -17,13 +17,14 @@ package cellsynt
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"sort"
+	"net/url"
 	"strings"
-
-	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 // Client holds username and password, and default values for messages
@@ -38,8 +39,38 @@ type Client struct {
 	OriginatorType     OriginatorType
 	Originator         string
 	Charset            Charset
-	AllowConcat        bool
+	AllowConcat        int
 	DefaultCountryCode string
+
+	// Endpoints are the gateway URLs, tried in order when one fails with a
+	// connection error or a 5xx response. DefaultEndpoint is used if empty.
+	Endpoints []string
+
+	// HTTPClient is used for all requests to the gateway. Set it to control
+	// timeouts or to use a custom transport. http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+
+	// Retry controls if failed requests are retried, no retries are made if nil.
+	Retry *RetryPolicy
+
+	// RateLimiter limits how fast messages are sent, if set
+	RateLimiter *RateLimiter
+
+	// Breaker stops requests while the gateway is failing, if set
+	Breaker *CircuitBreaker
+
+	// Logger receives debug output from the client, nothing is logged if nil
+	Logger Logger
+
+	// Metrics receives counters and latencies of sent messages, if set
+	Metrics Metrics
+
+	// Middleware wraps the sending of every message, the first middleware
+	// is the outermost
+	Middleware []Middleware
+
+	// Sandbox records messages instead of sending them to the gateway, if set
+	Sandbox *Sandbox
 }
 
 // Response will contain a success flag and the tracking ids that can
@@ -47,6 +78,10 @@ type Client struct {
 type Response struct {
 	Success     bool
 	TrackingIDs []string
+
+	// Attempts is the number of requests made to send the message, a
+	// *SendError holds it when sending fails
+	Attempts int
 }
 
 // NewClient returns a new client instance with some defaults set
@@ -58,7 +93,7 @@ func NewClient(username, password string, senderName string) *Client {
 		OriginatorType: OriginatorTypeAlpha,
 		Originator:     senderName,
 		Charset:        CharsetUTF8,
-		AllowConcat:    true,
+		AllowConcat:    MaxConcatParts,
 	}
 }
 
@@ -69,52 +104,241 @@ func (c *Client) getParameters() map[string]string {
 		"originatortype": string(c.OriginatorType),
 		"originator":     c.Originator,
 		"charset":        string(c.Charset),
-		"allowconcat":    ternaryStr(c.AllowConcat, "6", ""),
+		"allowconcat":    intStr(c.AllowConcat),
 	}
 	return clearEmpty(params)
 }
 
+func (c *Client) endpoints() []string {
+	if len(c.Endpoints) > 0 {
+		return c.Endpoints
+	}
+	return []string{DefaultEndpoint}
+}
+
+func (c *Client) logger() Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return NopLogger{}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
 // SendMessage dispatches a message to the destination
 func (c *Client) SendMessage(message Message) (*Response, error) {
+	return c.SendMessageContext(context.Background(), message)
+}
 
+// SendMessageContext dispatches a message to the destination. The request
+// is aborted if the context is canceled or its deadline expires.
+func (c *Client) SendMessageContext(ctx context.Context, message Message) (*Response, error) {
+	start := time.Now()
+	response, err := c.send(ctx, message)
+	c.observeSend(message, err, time.Since(start))
+	return response, err
+}
+
+// send validates and sends a message, retrying failed attempts
+func (c *Client) send(ctx context.Context, message Message) (*Response, error) {
 	if message.Destinations() == "" {
 		return nil, fmt.Errorf("message has no destination set")
 	}
+	if err := c.resolveDestination(message).Validate(); err != nil {
+		return nil, err
+	}
 
-	paramstr := c.messageParameters(message)
-	body := bytes.NewBuffer([]byte(paramstr))
+	if m, ok := message.(multipartMessage); ok {
+		parts, err := m.parts()
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) > 1 {
+			return c.sendParts(ctx, parts)
+		}
+	}
 
-	resp, err := http.Post(apiURL, "application/x-www-form-urlencoded", body)
+	params, err := c.messageParameters(message)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	responseData, err := ioutil.ReadAll(resp.Body)
+	req := &Request{
+		Message: message,
+		Params:  params,
+		Header:  http.Header{},
+	}
+	return c.handler()(ctx, req)
+}
+
+// sendParts sends the parts of a multipart message in order, the response
+// holds the tracking ids of all parts. If a part fails after others were
+// accepted, a *PartialSendError is returned with the accepted tracking ids.
+func (c *Client) sendParts(ctx context.Context, parts []Message) (*Response, error) {
+	response := &Response{Success: true}
+	for i, part := range parts {
+		r, err := c.send(ctx, part)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("part 1 of %d: %w", len(parts), err)
+			}
+			return nil, &PartialSendError{
+				Sent:        i,
+				Total:       len(parts),
+				TrackingIDs: response.TrackingIDs,
+				Err:         err,
+			}
+		}
+		response.TrackingIDs = append(response.TrackingIDs, r.TrackingIDs...)
+		response.Attempts += r.Attempts
+	}
+	return response, nil
+}
+
+// sendRequest sends a request to the gateway, retrying failed attempts
+func (c *Client) sendRequest(ctx context.Context, req *Request) (*Response, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	message := req.Message
+
+	var lastErr error
+	attempts := 0
+	for try := 1; ; try++ {
+		response, sent, err := c.attempt(ctx, req)
+		if sent {
+			attempts++
+		}
+		if err == nil {
+			response.Attempts = attempts
+
+			c.logger().Debug("sent message",
+				"type", message.Type(),
+				"recipients", len(req.recipients()),
+				"tracking_ids", response.TrackingIDs,
+				"attempts", attempts,
+			)
+
+			return response, nil
+		}
+		if errors.Is(err, ErrCircuitOpen) && lastErr != nil {
+			// the breaker was opened by the previous attempts, report their error
+			return nil, &SendError{Attempts: attempts, Err: lastErr}
+		}
+
+		c.logger().Debug("error sending message",
+			"type", message.Type(),
+			"recipients", len(req.recipients()),
+			"attempt", try,
+			"error", err.Error(),
+		)
+
+		if !c.Retry.shouldRetry(try, err) {
+			return nil, &SendError{Attempts: attempts, Err: err}
+		}
+		lastErr = err
+		if err := sleepContext(ctx, c.Retry.backoff(try)); err != nil {
+			return nil, &SendError{Attempts: attempts, Err: err}
+		}
+	}
+}
+
+// attempt makes a single request to the gateway when allowed. Waiting for
+// the rate limiter is done first, so it does not count toward the breaker.
+// Sent reports if the request was made.
+func (c *Client) attempt(ctx context.Context, req *Request) (response *Response, sent bool, err error) {
+	if err := c.wait(ctx, req); err != nil {
+		return nil, false, err
+	}
+
+	if c.Breaker != nil {
+		probe, openErr := c.Breaker.allow()
+		if openErr != nil {
+			return nil, false, openErr
+		}
+		defer func() { c.Breaker.record(probe, err) }()
+	}
+
+	if c.Sandbox != nil {
+		return c.Sandbox.record(req), true, nil
+	}
+	response, err = c.failover(ctx, req)
+	return response, true, err
+}
+
+// failover posts to each endpoint in order until one of them does not fail
+// with a connection error or a 5xx response
+func (c *Client) failover(ctx context.Context, req *Request) (response *Response, err error) {
+	for _, endpoint := range c.endpoints() {
+		response, err = c.post(ctx, endpoint, req)
+		if retryClass(err)&(RetryConnection|RetryServer) == 0 {
+			return response, err
+		}
+
+		c.logger().Warn("endpoint failed",
+			"endpoint", endpoint,
+			"error", err.Error(),
+		)
+	}
+	return response, err
+}
+
+// post makes a single request to the gateway
+func (c *Client) post(ctx context.Context, endpoint string, req *Request) (*Response, error) {
+	body := bytes.NewBufferString(encodeParameters(req.Params))
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
 	if err != nil {
 		return nil, err
 	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	response, err := c.handleResponse(responseData)
+	start := time.Now()
+	response, err := c.do(httpReq, req)
+	c.observeRequest(req.Message, err, time.Since(start))
+	return response, err
+}
+
+// do sends a request and parses the gateway response
+func (c *Client) do(httpReq *http.Request, req *Request) (*Response, error) {
+	resp, err := c.httpClient().Do(httpReq)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"destination": message.Destinations(),
-			"error":       err.Error(),
-			"type":        message.Type(),
-		}).Debug("error sending message", caller())
 		return nil, err
 	}
 
-	log.WithFields(log.Fields{
-		"type":         message.Type(),
-		"destination":  message.Destinations(),
-		"tracking_ids": response.TrackingIDs,
-	}).Debug("sent message")
+	defer resp.Body.Close()
+	responseData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		// the gateway may have accepted the message, this must never be retried
+		return nil, &responseReadError{err}
+	}
 
-	return response, nil
+	response, err := c.handleResponse(responseData)
+	if gwErr, ok := err.(*Error); ok {
+		gwErr.StatusCode = resp.StatusCode
+		gwErr.MessageType = req.Message.Type()
+		gwErr.Recipients = req.recipients()
+		if gwErr.Code == ErrorCodeUnexpectedResponse && resp.StatusCode >= 500 {
+			gwErr.Code = ErrorCodeServer
+		}
+	}
+	return response, err
 }
 
-func (c *Client) messageParameters(message Message) string {
+// messageParameters returns the parameters to post for a message
+func (c *Client) messageParameters(message Message) (map[string]string, error) {
+	if err := messageOptions(message).validate(); err != nil {
+		return nil, err
+	}
+
 	// get the message parameters
 	params := message.GetParameters()
 
@@ -128,17 +352,47 @@ func (c *Client) messageParameters(message Message) string {
 		}
 	}
 
-	// merge the params to a string that we can post
-	parts := []string{}
+	if dest := c.resolveDestination(message); dest != nil {
+		params["destination"] = dest.Destinations()
+	}
+
+	if err := resolveConcat(message, params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// encodeParameters returns the parameters as a form encoded request body,
+// leaving out empty values
+func encodeParameters(params map[string]string) string {
+	values := url.Values{}
 	for k, v := range params {
 		if v != "" {
-			parts = append(parts, k+"="+v)
+			values.Set(k, v)
 		}
 	}
+	return values.Encode()
+}
 
-	sort.Sort(ByKey(parts))
+// recipients returns the destinations a request is sent to
+func (r *Request) recipients() []string {
+	if r.Params["destination"] == "" {
+		return nil
+	}
+	return strings.Split(r.Params["destination"], ",")
+}
+
+// resolveDestination returns the destination of a message. National numbers
+// use the country code of the destination, or of the client if it has none.
+func (c *Client) resolveDestination(message Message) *Destination {
+	dest := messageDestination(message)
+	if dest == nil || dest.DefaultCountryCode != "" || c.DefaultCountryCode == "" {
+		return dest
+	}
 
-	return strings.Join(parts, "&")
+	resolved := *dest
+	resolved.DefaultCountryCode = c.DefaultCountryCode
+	return &resolved
 }
 
 func (c *Client) handleResponse(respBytes []byte) (*Response, error) {
@@ -153,9 +407,17 @@ func (c *Client) handleResponse(respBytes []byte) (*Response, error) {
 	}
 
 	if strings.HasPrefix(respStr, "Error: ") {
-		errstr := strings.TrimPrefix(respStr, "Error: ")
-		return nil, fmt.Errorf("%s", strings.TrimSpace(errstr))
+		errstr := strings.TrimSpace(strings.TrimPrefix(respStr, "Error: "))
+		return nil, &Error{
+			Code:    gatewayErrorCode(errstr),
+			Message: errstr,
+			Body:    respStr,
+		}
 	}
 
-	return nil, fmt.Errorf("response error: %s", respStr)
+	return nil, &Error{
+		Code:    ErrorCodeUnexpectedResponse,
+		Message: "response error: " + respStr,
+		Body:    respStr,
+	}
 }
@@ -16,8 +16,15 @@
 package cellsynt
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	t "github.com/greatbeyond/cellsynt/testing"
 	. "gopkg.in/check.v1"
@@ -33,16 +40,15 @@ type CellsyntSuite struct {
 	server *t.MockServer
 }
 
-func (suite *CellsyntSuite) SetUpSuite(c *C) {
-	apiURL = "http://mock.cellsynt.net/sms.php"
-}
+const mockEndpoint = "http://mock.cellsynt.net/sms.php"
 
 func (suite *CellsyntSuite) SetUpTest(c *C) {
 	suite.server = t.NewMockServer()
 	suite.server.SetChecker(c)
-	http.DefaultClient = suite.server.HTTPClient
 
 	suite.client = NewClient("username", "password", "sendername")
+	suite.client.HTTPClient = suite.server.HTTPClient
+	suite.client.Endpoints = []string{mockEndpoint}
 }
 
 func (suite *CellsyntSuite) TearDownTest(c *C) {
@@ -74,15 +80,16 @@ func (suite *CellsyntSuite) Test_Client_messageParameters_Normal(c *C) {
 		},
 		Text:        "test",
 		Charset:     CharsetUTF8,
-		AllowConcat: true,
+		AllowConcat: 6,
 		Options: &Options{
 			OriginatorType: OriginatorTypeAlpha,
 			Originator:     "test",
 		},
 	}
 
-	parameters := suite.client.messageParameters(r)
-	c.Assert(parameters, Equals, `allowconcat=6&charset=UTF-8&destination=0046703112233&originator=test&originatortype=alpha&password=password&text=test&type=text&username=username`)
+	parameters, err := suite.client.messageParameters(r)
+	c.Assert(err, IsNil)
+	c.Assert(encodeParameters(parameters), Equals, `charset=UTF-8&destination=0046703112233&originator=test&originatortype=alpha&password=password&text=test&type=text&username=username`)
 }
 
 func (suite *CellsyntSuite) Test_Client_messageParameters_Override(c *C) {
@@ -93,15 +100,136 @@ func (suite *CellsyntSuite) Test_Client_messageParameters_Override(c *C) {
 		},
 		Text:        "test",
 		Charset:     CharsetISO88591,
-		AllowConcat: true,
+		AllowConcat: 6,
 		Options: &Options{
 			OriginatorType: OriginatorTypeAlpha,
 			Originator:     "test",
 		},
 	}
 
-	parameters := suite.client.messageParameters(r)
-	c.Assert(parameters, Equals, `allowconcat=6&charset=ISO-8859-1&destination=0046703112233&originator=test&originatortype=alpha&password=password&text=test&type=text&username=username`)
+	parameters, err := suite.client.messageParameters(r)
+	c.Assert(err, IsNil)
+	c.Assert(encodeParameters(parameters), Equals, `charset=ISO-8859-1&destination=0046703112233&originator=test&originatortype=alpha&password=password&text=test&type=text&username=username`)
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_Concat(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: strings.Repeat("a", 200),
+	}
+
+	parameters, err := suite.client.messageParameters(r)
+	c.Assert(err, IsNil)
+	c.Assert(parameters["allowconcat"], Equals, "2")
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_TooLong(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text:        strings.Repeat("a", 400),
+		AllowConcat: 2,
+	}
+
+	_, err := suite.client.messageParameters(r)
+	c.Assert(errors.Is(err, ErrMessageTooLong), Equals, true)
+	c.Assert(err, ErrorMatches, "message too long: text needs 3 parts, at most 2 allowed")
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_NoConcat(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: strings.Repeat("a", 161),
+	}
+
+	suite.client.AllowConcat = 0
+	_, err := suite.client.messageParameters(r)
+	c.Assert(err, ErrorMatches, "message too long: text needs 2 parts, at most 1 allowed")
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_InvalidConcat(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text:        "test",
+		AllowConcat: 7,
+	}
+
+	_, err := suite.client.messageParameters(r)
+	c.Assert(err, ErrorMatches, "allowconcat must be between 1 and 6, got 7")
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_TooLong(c *C) {
+	r := &UnicodeMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: strings.Repeat("Ω", 403),
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrMessageTooLong), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_CountryCode(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0703112233", "+4741234567"},
+		},
+		Text: "test",
+	}
+
+	suite.client.DefaultCountryCode = "46"
+	parameters, err := suite.client.messageParameters(r)
+	c.Assert(err, IsNil)
+	c.Assert(encodeParameters(parameters), Equals, `charset=UTF-8&destination=0046703112233%2C004741234567&originator=sendername&originatortype=alpha&password=password&text=test&type=text&username=username`)
+
+	// the destination country code has priority over the client
+	r.DefaultCountryCode = "47"
+	r.Recipients = []string{"41234567"}
+	parameters, err = suite.client.messageParameters(r)
+	c.Assert(err, IsNil)
+	c.Assert(encodeParameters(parameters), Equals, `charset=UTF-8&destination=004741234567&originator=sendername&originatortype=alpha&password=password&text=test&type=text&username=username`)
+
+	// the message is not modified
+	c.Assert(r.Destinations(), Equals, "004741234567")
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_MissingCountryCode(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0703112233"},
+		},
+		Text: "test",
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrInvalidDestination), Equals, true)
+
+	var invalid *InvalidRecipientsError
+	c.Assert(errors.As(err, &invalid), Equals, true)
+	c.Assert(invalid.Recipients[0].Err, Equals, ErrMissingCountryCode)
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_InvalidValidity(c *C) {
+	r := &FlashMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Options: &Options{
+			Validity: 30 * 24 * time.Hour,
+		},
+		Text: "test",
+	}
+
+	_, err := suite.client.messageParameters(r)
+	c.Assert(errors.Is(err, ErrInvalidParameter), Equals, true)
 }
 
 // -------------------------------------------------------------
@@ -140,6 +268,7 @@ func (suite *CellsyntSuite) Test_Client_handleResponse_Failure(c *C) {
 	response, err := suite.client.handleResponse(rb)
 
 	c.Assert(err, ErrorMatches, "Parameter destination must be set")
+	c.Assert(errors.Is(err, ErrInvalidDestination), Equals, true)
 	c.Assert(response, IsNil)
 }
 
@@ -148,6 +277,7 @@ func (suite *CellsyntSuite) Test_Client_handleResponse_BadResponse(c *C) {
 	response, err := suite.client.handleResponse(rb)
 
 	c.Assert(err, ErrorMatches, "response error: unexpected response")
+	c.Assert(errors.Is(err, ErrUnexpectedResponse), Equals, true)
 	c.Assert(response, IsNil)
 }
 
@@ -173,6 +303,17 @@ func (suite *CellsyntSuite) Test_Client_SendMessage_MissingDestination_2(c *C) {
 	c.Assert(err, ErrorMatches, "message has no destination set")
 }
 
+func (suite *CellsyntSuite) Test_Client_SendMessage_InvalidRecipient(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "555-123-45"},
+		},
+		Text: "test",
+	}
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, ErrorMatches, `invalid recipients: 555-123-45 \(national number has no country code\)`)
+}
+
 func (suite *CellsyntSuite) Test_Client_SendMessage_Normal(c *C) {
 
 	r := &TextMessage{
@@ -181,7 +322,7 @@ func (suite *CellsyntSuite) Test_Client_SendMessage_Normal(c *C) {
 		},
 		Text:        "test",
 		Charset:     CharsetUTF8,
-		AllowConcat: true,
+		AllowConcat: 6,
 		Options: &Options{
 			OriginatorType: OriginatorTypeAlpha,
 			Originator:     "test",
@@ -193,8 +334,8 @@ func (suite *CellsyntSuite) Test_Client_SendMessage_Normal(c *C) {
 		Code:   200,
 		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
 		CheckFn: func(r *http.Request, body string) {
-			c.Assert(r.RequestURI, Equals, apiURL)
-			c.Assert(body, Equals, "allowconcat=6&charset=UTF-8&destination=0046703112233&originator=test&originatortype=alpha&password=password&text=test&type=text&username=username")
+			c.Assert(r.RequestURI, Equals, mockEndpoint)
+			c.Assert(body, Equals, "charset=UTF-8&destination=0046703112233&originator=test&originatortype=alpha&password=password&text=test&type=text&username=username")
 		},
 	})
 
@@ -206,6 +347,7 @@ func (suite *CellsyntSuite) Test_Client_SendMessage_Normal(c *C) {
 		TrackingIDs: []string{
 			"de8c4a032fb45ae65ab9e349a8dc2458",
 		},
+		Attempts: 1,
 	})
 }
 
@@ -222,8 +364,8 @@ func (suite *CellsyntSuite) Test_Client_SendMessage_Error(c *C) {
 		Code:   501,
 		Body:   "Error: mocked error",
 		CheckFn: func(r *http.Request, body string) {
-			c.Assert(r.RequestURI, Equals, apiURL)
-			c.Assert(body, Equals, "allowconcat=6&charset=UTF-8&destination=0046703112233&originator=sendername&originatortype=alpha&password=password&text=test&type=text&username=username")
+			c.Assert(r.RequestURI, Equals, mockEndpoint)
+			c.Assert(body, Equals, "charset=UTF-8&destination=0046703112233&originator=sendername&originatortype=alpha&password=password&text=test&type=text&username=username")
 		},
 	})
 
@@ -232,3 +374,562 @@ func (suite *CellsyntSuite) Test_Client_SendMessage_Error(c *C) {
 	c.Assert(err, ErrorMatches, "mocked error")
 	c.Assert(response, IsNil)
 }
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_TypedError(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703112244"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Invalid username or password",
+	})
+
+	_, err := suite.client.SendMessage(r)
+
+	c.Assert(errors.Is(err, ErrAuthentication), Equals, true)
+
+	var gwErr *Error
+	c.Assert(errors.As(err, &gwErr), Equals, true)
+	c.Assert(gwErr, DeepEquals, &Error{
+		Code:        ErrorCodeAuthentication,
+		Message:     "Invalid username or password",
+		Body:        "Error: Invalid username or password\n",
+		StatusCode:  200,
+		MessageType: "text",
+		Recipients:  []string{"0046703112233", "0046703112244"},
+	})
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_TypedErrorCountryCode(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0703112233", "+4741234567"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Invalid destination",
+	})
+
+	suite.client.DefaultCountryCode = "46"
+	_, err := suite.client.SendMessage(r)
+
+	var gwErr *Error
+	c.Assert(errors.As(err, &gwErr), Equals, true)
+	c.Assert(gwErr.Recipients, DeepEquals, []string{"0046703112233", "004741234567"})
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_ServerError(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+
+	_, err := suite.client.SendMessage(r)
+
+	c.Assert(errors.Is(err, ErrServer), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessageContext_Canceled(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	response, err := suite.client.SendMessageContext(ctx, r)
+
+	c.Assert(err, ErrorMatches, ".*context canceled")
+	c.Assert(response, IsNil)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessageContext_Deadline(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		CheckFn: func(r *http.Request, body string) {
+			time.Sleep(100 * time.Millisecond)
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	response, err := suite.client.SendMessageContext(ctx, r)
+
+	c.Assert(err, ErrorMatches, ".*context deadline exceeded")
+	c.Assert(response, IsNil)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_CustomTransport(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(r.Header.Get("X-Test"), Equals, "transport")
+		},
+	})
+
+	transport := suite.server.HTTPClient.Transport
+	suite.client.HTTPClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r.Header.Set("X-Test", "transport")
+			return transport.RoundTrip(r)
+		}),
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+}
+
+// -------------------------------------------------------------
+// Encoding
+
+func (suite *CellsyntSuite) Test_encodeParameters(c *C) {
+	c.Assert(encodeParameters(map[string]string{
+		"text":       "a&b=c+d e%",
+		"originator": "",
+		"charset":    "UTF-8",
+	}), Equals, "charset=UTF-8&text=a%26b%3Dc%2Bd+e%25")
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_SpecialCharacters(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "+4741234567"},
+		},
+		Text: "50% off & more: a+b=c? #åäö\nnext",
+		Options: &Options{
+			OriginatorType: OriginatorTypeAlpha,
+			Originator:     "A&B=C+D",
+		},
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458,ae65ab9e349a8dc2458de8c4a032fb45",
+		CheckFn: func(r *http.Request, body string) {
+			values, err := url.ParseQuery(body)
+			c.Assert(err, IsNil)
+			c.Assert(values, DeepEquals, url.Values{
+				"username":       {"user&name"},
+				"password":       {"p&ss=w+rd %20"},
+				"destination":    {"0046703112233,004741234567"},
+				"originatortype": {"alpha"},
+				"originator":     {"A&B=C+D"},
+				"charset":        {"UTF-8"},
+				"type":           {"text"},
+				"text":           {"50% off & more: a+b=c? #åäö\nnext"},
+			})
+		},
+	})
+
+	suite.client.Username = "user&name"
+	suite.client.Password = "p&ss=w+rd %20"
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_BinaryEncoding(c *C) {
+	r := &BinaryMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Binary: []byte{0x00, '&', '=', '+', 0xff},
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		CheckFn: func(r *http.Request, body string) {
+			values, err := url.ParseQuery(body)
+			c.Assert(err, IsNil)
+			c.Assert(values.Get("data"), Equals, "00263D2BFF")
+			c.Assert(values.Get("type"), Equals, "binary")
+		},
+	})
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_BinaryMultipart(c *C) {
+	data := make([]byte, 200)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	r := &BinaryMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Binary: data,
+	}
+
+	var ref string
+	for i, id := range []string{"de8c4a032fb45ae65ab9e349a8dc2458", "ae65ab9e349a8dc2458de8c4a032fb45"} {
+		part := i + 1
+		suite.server.AddResponse(&t.MockResponse{
+			Method: "POST",
+			Code:   200,
+			Body:   "OK: " + id,
+			CheckFn: func(r *http.Request, body string) {
+				values, err := url.ParseQuery(body)
+				c.Assert(err, IsNil)
+
+				udh := values.Get("udh")
+				c.Assert(udh, Matches, fmt.Sprintf("050003[0-9A-F]{2}020%d", part))
+				if ref == "" {
+					ref = udh[6:8]
+				}
+				c.Assert(udh[6:8], Equals, ref)
+
+				if part == 1 {
+					c.Assert(values.Get("data"), HasLen, 134*2)
+				} else {
+					c.Assert(values.Get("data"), HasLen, 66*2)
+				}
+			},
+		})
+	}
+
+	response, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+	c.Assert(response.TrackingIDs, DeepEquals, []string{"de8c4a032fb45ae65ab9e349a8dc2458", "ae65ab9e349a8dc2458de8c4a032fb45"})
+	c.Assert(response.Attempts, Equals, 2)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_BinaryPartial(c *C) {
+	r := &BinaryMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Binary: make([]byte, 300),
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, ErrorMatches, "part 2 of 3: response error: Service Unavailable\n")
+	c.Assert(errors.Is(err, ErrServer), Equals, true)
+	c.Assert(IsRetryable(err), Equals, false)
+
+	var partialErr *PartialSendError
+	c.Assert(errors.As(err, &partialErr), Equals, true)
+	c.Assert(partialErr.Sent, Equals, 1)
+	c.Assert(partialErr.Total, Equals, 3)
+	c.Assert(partialErr.TrackingIDs, DeepEquals, []string{"de8c4a032fb45ae65ab9e349a8dc2458"})
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_BinaryFirstPartFails(c *C) {
+	r := &BinaryMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Binary: make([]byte, 300),
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+
+	// nothing was accepted, so the message can be sent again
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, ErrorMatches, "part 1 of 3: response error: Service Unavailable\n")
+	c.Assert(IsRetryable(err), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_messageParameters_BinaryTooLong(c *C) {
+	r := &BinaryMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Binary: make([]byte, 141),
+	}
+
+	_, err := suite.client.messageParameters(r)
+	c.Assert(errors.Is(err, ErrMessageTooLong), Equals, true)
+}
+
+// -------------------------------------------------------------
+// Endpoints
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_Failover(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(r.RequestURI, Equals, "http://primary.cellsynt.net/sms.php")
+		},
+	})
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(r.RequestURI, Equals, "http://secondary.cellsynt.net/sms.php")
+		},
+	})
+
+	suite.client.Endpoints = []string{
+		"http://primary.cellsynt.net/sms.php",
+		"http://secondary.cellsynt.net/sms.php",
+	}
+
+	response, err := suite.client.SendMessage(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(response.Attempts, Equals, 1)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_NoFailoverGatewayError(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Invalid destination",
+	})
+
+	suite.client.Endpoints = []string{
+		"http://primary.cellsynt.net/sms.php",
+		"http://secondary.cellsynt.net/sms.php",
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrInvalidDestination), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_AllEndpointsFail(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   502,
+		Body:   "Bad Gateway",
+	})
+
+	suite.client.HTTPClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Host == "primary.cellsynt.net" {
+				return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+			}
+			return suite.server.HTTPClient.Transport.RoundTrip(r)
+		}),
+	}
+	suite.client.Endpoints = []string{
+		"http://primary.cellsynt.net/sms.php",
+		"http://secondary.cellsynt.net/sms.php",
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrServer), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_endpoints_Default(c *C) {
+	client := NewClient("username", "password", "sendername")
+	c.Assert(client.endpoints(), DeepEquals, []string{DefaultEndpoint})
+}
+
+// -------------------------------------------------------------
+// Retries
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_RetryServerError(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	suite.client.Retry = &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+
+	response, err := suite.client.SendMessage(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(response, DeepEquals, &Response{
+		Success: true,
+		TrackingIDs: []string{
+			"de8c4a032fb45ae65ab9e349a8dc2458",
+		},
+		Attempts: 2,
+	})
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_RetryExhausted(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	for i := 0; i < 2; i++ {
+		suite.server.AddResponse(&t.MockResponse{
+			Method: "POST",
+			Code:   502,
+			Body:   "Bad Gateway",
+		})
+	}
+
+	suite.client.Retry = &RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+	}
+
+	response, err := suite.client.SendMessage(r)
+	c.Assert(response, IsNil)
+	c.Assert(errors.Is(err, ErrServer), Equals, true)
+
+	var sendErr *SendError
+	c.Assert(errors.As(err, &sendErr), Equals, true)
+	c.Assert(sendErr.Attempts, Equals, 2)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_NoRetryGatewayError(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Invalid username or password",
+	})
+
+	suite.client.Retry = &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrAuthentication), Equals, true)
+
+	var sendErr *SendError
+	c.Assert(errors.As(err, &sendErr), Equals, true)
+	c.Assert(sendErr.Attempts, Equals, 1)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_RetryConnection(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	dials := 0
+	transport := suite.server.HTTPClient.Transport
+	suite.client.HTTPClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			dials++
+			if dials == 1 {
+				return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+			}
+			return transport.RoundTrip(r)
+		}),
+	}
+	suite.client.Retry = &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+
+	response, err := suite.client.SendMessage(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(response.Attempts, Equals, 2)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -16,26 +16,27 @@
 package cellsynt
 
 import (
-	"fmt"
-	"regexp"
-	"runtime"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
 	"strings"
 )
 
-func ternaryStr(cond bool, a, b string) string {
-	if cond {
-		return a
+// intStr formats n, or returns an empty string if n is 0
+func intStr(n int) string {
+	if n == 0 {
+		return ""
 	}
-	return b
+	return strconv.Itoa(n)
 }
 
-func caller() string {
-	_, file, line, _ := runtime.Caller(1)
-	matcher := regexp.MustCompile("^(.*)/(.*?)\\.go$")
-	matches := matcher.FindAllStringSubmatch(file, -1)
-	msg := fmt.Sprintf(" [cellsynt/%s.go:%d]", matches[0][2], line)
-
-	return msg
+// randomID returns a random 32 character hex string
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }
 
 // Merge b into a by copying values, giving priority to a
@@ -61,6 +62,8 @@ func clearEmpty(params map[string]string) map[string]string {
 }
 
 // ByKey is sorting of parameter fields by key
+//
+// Deprecated: parameters are encoded with url.Values, ByKey is no longer used.
 type ByKey []string
 
 func (s ByKey) Len() int {
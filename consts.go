@@ -15,7 +15,8 @@
 
 package cellsynt
 
-var apiURL = "https://se-1.cellsynt.net/sms.php"
+// DefaultEndpoint is used by clients without endpoints
+const DefaultEndpoint = "https://se-1.cellsynt.net/sms.php"
 
 type OriginatorType string
 
@@ -0,0 +1,139 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeliveryStatus is the state of a message in a delivery report
+type DeliveryStatus string
+
+const (
+	DeliveryStatusBuffered  DeliveryStatus = "buffered"
+	DeliveryStatusDelivered DeliveryStatus = "delivered"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+// timestampLayout is the layout of non-numeric timestamps in callbacks
+const timestampLayout = "2006-01-02 15:04:05"
+
+// DeliveryReport is the delivery status of a message to one recipient,
+// sent by the gateway to the configured callback URL.
+type DeliveryReport struct {
+	// TrackingID matches one of the ids in Response.TrackingIDs
+	TrackingID  string
+	Destination string
+	Status      DeliveryStatus
+	Timestamp   time.Time
+	// ErrorCode is set by the operator when delivery failed
+	ErrorCode int
+}
+
+// ParseDeliveryReport reads a delivery report from the query or form
+// parameters of a gateway callback request.
+func ParseDeliveryReport(r *http.Request) (*DeliveryReport, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	report := &DeliveryReport{
+		TrackingID:  strings.TrimSpace(r.Form.Get("trackingid")),
+		Destination: strings.TrimSpace(r.Form.Get("destination")),
+		Status:      DeliveryStatus(strings.ToLower(strings.TrimSpace(r.Form.Get("status")))),
+	}
+
+	if report.TrackingID == "" {
+		return nil, fmt.Errorf("delivery report has no tracking id")
+	}
+
+	switch report.Status {
+	case DeliveryStatusBuffered, DeliveryStatusDelivered, DeliveryStatusFailed:
+	default:
+		return nil, fmt.Errorf("delivery report has unknown status %q", report.Status)
+	}
+
+	if ts := r.Form.Get("timestamp"); ts != "" {
+		timestamp, err := parseTimestamp(ts)
+		if err != nil {
+			return nil, fmt.Errorf("delivery report has invalid timestamp %q", ts)
+		}
+		report.Timestamp = timestamp
+	}
+
+	if code := r.Form.Get("errorcode"); code != "" {
+		errorCode, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("delivery report has invalid error code %q", code)
+		}
+		report.ErrorCode = errorCode
+	}
+
+	return report, nil
+}
+
+// parseTimestamp parses a unix timestamp or a date on the form
+// "2006-01-02 15:04:05" in UTC
+func parseTimestamp(ts string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(ts, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Parse(timestampLayout, ts)
+}
+
+// DeliveryReportHandler is a http.Handler receiving delivery reports from
+// the gateway. Each valid report is passed to Callback and Reports, if set.
+type DeliveryReportHandler struct {
+	// Callback is called with every report. If it returns an error the
+	// gateway is told that the report was not received.
+	Callback func(*DeliveryReport) error
+
+	// Reports receives every report. The request is held until the report
+	// is received or the request is canceled.
+	Reports chan<- *DeliveryReport
+}
+
+// ServeHTTP implements http.Handler
+func (h *DeliveryReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, err := ParseDeliveryReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.Callback != nil {
+		if err := h.Callback(report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if h.Reports != nil {
+		select {
+		case h.Reports <- report:
+		case <-r.Context().Done():
+			http.Error(w, "report not received", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "OK")
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&DeliveryReportSuite{})
+
+type DeliveryReportSuite struct{}
+
+// -------------------------------------------------------------
+// Parsing
+
+func (suite *DeliveryReportSuite) Test_ParseDeliveryReport_Query(c *C) {
+	r := httptest.NewRequest("GET", "/dlr?trackingid=de8c4a032fb45ae65ab9e349a8dc2458&destination=0046703112233&status=delivered&timestamp=1475232000", nil)
+
+	report, err := ParseDeliveryReport(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(report, DeepEquals, &DeliveryReport{
+		TrackingID:  "de8c4a032fb45ae65ab9e349a8dc2458",
+		Destination: "0046703112233",
+		Status:      DeliveryStatusDelivered,
+		Timestamp:   time.Date(2016, 9, 30, 10, 40, 0, 0, time.UTC),
+	})
+}
+
+func (suite *DeliveryReportSuite) Test_ParseDeliveryReport_Form(c *C) {
+	body := strings.NewReader("trackingid=de8c4a032fb45ae65ab9e349a8dc2458&status=FAILED&timestamp=2016-09-30+10%3A40%3A00&errorcode=34")
+	r := httptest.NewRequest("POST", "/dlr", body)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	report, err := ParseDeliveryReport(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(report, DeepEquals, &DeliveryReport{
+		TrackingID: "de8c4a032fb45ae65ab9e349a8dc2458",
+		Status:     DeliveryStatusFailed,
+		Timestamp:  time.Date(2016, 9, 30, 10, 40, 0, 0, time.UTC),
+		ErrorCode:  34,
+	})
+}
+
+func (suite *DeliveryReportSuite) Test_ParseDeliveryReport_Invalid(c *C) {
+	for query, msg := range map[string]string{
+		"status=delivered":                                   "delivery report has no tracking id",
+		"trackingid=abc&status=lost":                         `delivery report has unknown status "lost"`,
+		"trackingid=abc&status=buffered&timestamp=yesterday": `delivery report has invalid timestamp "yesterday"`,
+		"trackingid=abc&status=failed&errorcode=x":           `delivery report has invalid error code "x"`,
+	} {
+		r := httptest.NewRequest("GET", "/dlr?"+query, nil)
+		_, err := ParseDeliveryReport(r)
+		c.Assert(err, ErrorMatches, msg)
+	}
+}
+
+// -------------------------------------------------------------
+// Handler
+
+func (suite *DeliveryReportSuite) Test_DeliveryReportHandler_Callback(c *C) {
+	var received *DeliveryReport
+	h := &DeliveryReportHandler{
+		Callback: func(report *DeliveryReport) error {
+			received = report
+			return nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/dlr?trackingid=abc&status=buffered", nil))
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(received, NotNil)
+	c.Assert(received.Status, Equals, DeliveryStatusBuffered)
+}
+
+func (suite *DeliveryReportSuite) Test_DeliveryReportHandler_CallbackError(c *C) {
+	h := &DeliveryReportHandler{
+		Callback: func(report *DeliveryReport) error {
+			return fmt.Errorf("storage unavailable")
+		},
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/dlr?trackingid=abc&status=buffered", nil))
+
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+}
+
+func (suite *DeliveryReportSuite) Test_DeliveryReportHandler_Channel(c *C) {
+	reports := make(chan *DeliveryReport, 1)
+	h := &DeliveryReportHandler{Reports: reports}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/dlr?trackingid=abc&status=delivered", nil))
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert((<-reports).TrackingID, Equals, "abc")
+}
+
+func (suite *DeliveryReportSuite) Test_DeliveryReportHandler_BadRequest(c *C) {
+	h := &DeliveryReportHandler{}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/dlr?status=delivered", nil))
+
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode categorizes errors returned by the gateway
+type ErrorCode string
+
+const (
+	ErrorCodeAuthentication     ErrorCode = "authentication"
+	ErrorCodeInvalidDestination ErrorCode = "invalid_destination"
+	ErrorCodeInvalidOriginator  ErrorCode = "invalid_originator"
+	ErrorCodeInvalidParameter   ErrorCode = "invalid_parameter"
+	ErrorCodeInsufficientCredit ErrorCode = "insufficient_credit"
+	ErrorCodeServer             ErrorCode = "server"
+	ErrorCodeUnexpectedResponse ErrorCode = "unexpected_response"
+	ErrorCodeGateway            ErrorCode = "gateway"
+)
+
+// Sentinel errors that an *Error unwraps to, use with errors.Is
+var (
+	ErrAuthentication     = errors.New("authentication failed")
+	ErrInvalidDestination = errors.New("invalid destination")
+	ErrInvalidOriginator  = errors.New("invalid originator")
+	ErrInvalidParameter   = errors.New("invalid parameter")
+	ErrInsufficientCredit = errors.New("insufficient credit")
+	ErrServer             = errors.New("server error")
+	ErrUnexpectedResponse = errors.New("unexpected response")
+	ErrGateway            = errors.New("gateway error")
+)
+
+var errorSentinels = map[ErrorCode]error{
+	ErrorCodeAuthentication:     ErrAuthentication,
+	ErrorCodeInvalidDestination: ErrInvalidDestination,
+	ErrorCodeInvalidOriginator:  ErrInvalidOriginator,
+	ErrorCodeInvalidParameter:   ErrInvalidParameter,
+	ErrorCodeInsufficientCredit: ErrInsufficientCredit,
+	ErrorCodeServer:             ErrServer,
+	ErrorCodeUnexpectedResponse: ErrUnexpectedResponse,
+	ErrorCodeGateway:            ErrGateway,
+}
+
+// errorPatterns maps known gateway error texts to an error code. The
+// patterns are matched in order against the lower cased error text.
+var errorPatterns = []struct {
+	pattern string
+	code    ErrorCode
+}{
+	{"username", ErrorCodeAuthentication},
+	{"password", ErrorCodeAuthentication},
+	{"authenticat", ErrorCodeAuthentication},
+	{"credit", ErrorCodeInsufficientCredit},
+	{"balance", ErrorCodeInsufficientCredit},
+	{"destination", ErrorCodeInvalidDestination},
+	{"originator", ErrorCodeInvalidOriginator},
+	{"parameter", ErrorCodeInvalidParameter},
+}
+
+// Error is returned when the gateway does not accept a message
+type Error struct {
+	// Code is the category of the error
+	Code ErrorCode
+	// Message is the error text sent by the gateway
+	Message string
+	// Body is the unparsed response body
+	Body string
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+
+	// MessageType and Recipients describe the message that failed
+	MessageType string
+	Recipients  []string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel error matching the error code
+func (e *Error) Unwrap() error {
+	return errorSentinels[e.Code]
+}
+
+// SendError is returned when a message could not be sent after one or more
+// requests to the gateway. It wraps the error of the last attempt, use
+// errors.As or errors.Is to inspect it.
+type SendError struct {
+	// Attempts is the number of requests made
+	Attempts int
+	Err      error
+}
+
+func (e *SendError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the last attempt
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// PartialSendError is returned when a multipart message fails after some of
+// its parts were accepted by the gateway. It is never retried, as that would
+// send the accepted parts again.
+type PartialSendError struct {
+	// Sent is the number of parts accepted, out of Total
+	Sent, Total int
+	// TrackingIDs are the tracking ids of the accepted parts
+	TrackingIDs []string
+	// Err is the error of the part that failed
+	Err error
+}
+
+func (e *PartialSendError) Error() string {
+	return fmt.Sprintf("part %d of %d: %s", e.Sent+1, e.Total, e.Err)
+}
+
+// Unwrap returns the error of the part that failed
+func (e *PartialSendError) Unwrap() error {
+	return e.Err
+}
+
+// gatewayErrorCode returns the error code for a gateway error text
+func gatewayErrorCode(text string) ErrorCode {
+	text = strings.ToLower(text)
+	for _, p := range errorPatterns {
+		if strings.Contains(text, p.pattern) {
+			return p.code
+		}
+	}
+	return ErrorCodeGateway
+}
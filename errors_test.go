@@ -0,0 +1,58 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ErrorsSuite{})
+
+type ErrorsSuite struct{}
+
+// -------------------------------------------------------------
+// Error codes
+
+func (suite *ErrorsSuite) Test_gatewayErrorCode(c *C) {
+	for text, code := range map[string]ErrorCode{
+		"Invalid username or password":       ErrorCodeAuthentication,
+		"Parameter destination must be set":  ErrorCodeInvalidDestination,
+		"Invalid destination: 0046":          ErrorCodeInvalidDestination,
+		"Not enough credits":                 ErrorCodeInsufficientCredit,
+		"Invalid originator":                 ErrorCodeInvalidOriginator,
+		"Parameter text must be set":         ErrorCodeInvalidParameter,
+		"Something unexpected went terribly": ErrorCodeGateway,
+	} {
+		c.Assert(gatewayErrorCode(text), Equals, code, Commentf(text))
+	}
+}
+
+func (suite *ErrorsSuite) Test_Error_Is(c *C) {
+	var err error = &Error{
+		Code:    ErrorCodeInsufficientCredit,
+		Message: "Not enough credits",
+	}
+
+	c.Assert(err, ErrorMatches, "Not enough credits")
+	c.Assert(errors.Is(err, ErrInsufficientCredit), Equals, true)
+	c.Assert(errors.Is(err, ErrAuthentication), Equals, false)
+
+	var gwErr *Error
+	c.Assert(errors.As(err, &gwErr), Equals, true)
+	c.Assert(gwErr.Code, Equals, ErrorCodeInsufficientCredit)
+}
@@ -0,0 +1,196 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gsmEscape switches to the extension table for the next septet
+const gsmEscape = 0x1B
+
+// gsmBasic is the GSM 03.38 default alphabet, indexed by septet
+var gsmBasic = [128]rune{
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì', 'ò', 'Ç', '\n', 'Ø', 'ø', '\r', 'Å', 'å',
+	'Δ', '_', 'Φ', 'Γ', 'Λ', 'Ω', 'Π', 'Ψ', 'Σ', 'Θ', 'Ξ', 0, 'Æ', 'æ', 'ß', 'É',
+	' ', '!', '"', '#', '¤', '%', '&', '\'', '(', ')', '*', '+', ',', '-', '.', '/',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', ':', ';', '<', '=', '>', '?',
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G', 'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O',
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', 'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§',
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o',
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', 'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à',
+}
+
+// gsmExtension is the GSM 03.38 extension table, reached by an escape septet
+var gsmExtension = map[byte]rune{
+	0x0A: '\f',
+	0x14: '^',
+	0x28: '{',
+	0x29: '}',
+	0x2F: '\\',
+	0x3C: '[',
+	0x3D: '~',
+	0x3E: ']',
+	0x40: '|',
+	0x65: '€',
+}
+
+var (
+	gsmBasicIndex     = map[rune]byte{}
+	gsmExtensionIndex = map[rune]byte{}
+)
+
+func init() {
+	for i, r := range gsmBasic {
+		if i != gsmEscape {
+			gsmBasicIndex[r] = byte(i)
+		}
+	}
+	for b, r := range gsmExtension {
+		gsmExtensionIndex[r] = b
+	}
+}
+
+// IsGSM reports if all characters in text can be encoded with the GSM 03.38
+// alphabet, including the extension table.
+func IsGSM(text string) bool {
+	for _, r := range text {
+		if !isGSMRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isGSMRune(r rune) bool {
+	if _, ok := gsmBasicIndex[r]; ok {
+		return true
+	}
+	_, ok := gsmExtensionIndex[r]
+	return ok
+}
+
+// EncodeGSM encodes text as unpacked GSM 03.38 septets, one per byte.
+// Characters from the extension table are encoded as two septets.
+func EncodeGSM(text string) ([]byte, error) {
+	septets := make([]byte, 0, len(text))
+	position := 0
+	for _, r := range text {
+		if b, ok := gsmBasicIndex[r]; ok {
+			septets = append(septets, b)
+		} else if b, ok := gsmExtensionIndex[r]; ok {
+			septets = append(septets, gsmEscape, b)
+		} else {
+			return nil, fmt.Errorf("character %q at position %d is not in the GSM alphabet", r, position)
+		}
+		position++
+	}
+	return septets, nil
+}
+
+// DecodeGSM decodes unpacked GSM 03.38 septets to a string
+func DecodeGSM(septets []byte) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(septets); i++ {
+		s := septets[i]
+		if s > 0x7F {
+			return "", fmt.Errorf("invalid septet 0x%02X at position %d", s, i)
+		}
+		if s != gsmEscape {
+			b.WriteRune(gsmBasic[s])
+			continue
+		}
+
+		i++
+		if i == len(septets) {
+			return "", fmt.Errorf("escape septet at end of input")
+		}
+		r, ok := gsmExtension[septets[i]]
+		if !ok {
+			return "", fmt.Errorf("invalid extension septet 0x%02X at position %d", septets[i], i)
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), nil
+}
+
+// gsmTransliterations are replacements for common characters outside the
+// GSM alphabet
+var gsmTransliterations = map[rune]string{
+	'á': "a", 'â': "a", 'ã': "a", 'ā': "a", 'ą': "a",
+	'Á': "A", 'À': "A", 'Â': "A", 'Ã': "A", 'Ā': "A", 'Ą': "A",
+	'ç': "c", 'ć': "c", 'č': "c", 'Ć': "C", 'Č': "C",
+	'ď': "d", 'Ď': "D", 'ð': "d", 'Ð': "D",
+	'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e",
+	'È': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ę': "E", 'Ě': "E",
+	'í': "i", 'î': "i", 'ï': "i", 'ī': "i",
+	'Í': "I", 'Ì': "I", 'Î': "I", 'Ï': "I", 'Ī': "I",
+	'ł': "l", 'Ł': "L",
+	'ń': "n", 'ň': "n", 'Ń': "N", 'Ň': "N",
+	'ó': "o", 'ô': "o", 'õ': "o", 'ō': "o", 'ő': "ö",
+	'Ó': "O", 'Ò': "O", 'Ô': "O", 'Õ': "O", 'Ō': "O", 'Ő': "Ö",
+	'ř': "r", 'Ř': "R",
+	'ś': "s", 'š': "s", 'Ś': "S", 'Š': "S",
+	'ť': "t", 'Ť': "T", 'þ': "th", 'Þ': "Th",
+	'ú': "u", 'û': "u", 'ū': "u", 'ů': "u", 'ű': "ü",
+	'Ú': "U", 'Ù': "U", 'Û': "U", 'Ū': "U", 'Ů': "U", 'Ű': "Ü",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y", 'Ÿ': "Y",
+	'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+	'œ': "oe", 'Œ': "OE",
+	'‘': "'", '’': "'", '‚': "'", '′': "'",
+	'“': "\"", '”': "\"", '„': "\"", '«': "\"", '»': "\"", '″': "\"",
+	'–': "-", '—': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".",
+	'\t': " ", '\u00A0': " ", '\u2009': " ", '\u202F': " ",
+	'\u200B': "", '\uFEFF': "",
+}
+
+// TransliterateGSM replaces characters outside the GSM alphabet with their
+// closest equivalent. Characters without an equivalent are replaced with '?'.
+func TransliterateGSM(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if isGSMRune(r) {
+			b.WriteRune(r)
+		} else if s, ok := gsmTransliterations[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune('?')
+		}
+	}
+	return b.String()
+}
+
+// NewMessage returns a TextMessage if the text can be sent with the GSM
+// alphabet, otherwise a UnicodeMessage. If transliterate is set, characters
+// outside the alphabet are replaced and a TextMessage is always returned.
+func NewMessage(text string, destination *Destination, transliterate bool) Message {
+	if !IsGSM(text) {
+		if !transliterate {
+			return &UnicodeMessage{
+				Text:        text,
+				Destination: destination,
+			}
+		}
+		text = TransliterateGSM(text)
+	}
+
+	return &TextMessage{
+		Text:        text,
+		Destination: destination,
+	}
+}
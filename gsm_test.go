@@ -0,0 +1,117 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import . "gopkg.in/check.v1"
+
+var _ = Suite(&GSMSuite{})
+
+type GSMSuite struct{}
+
+// -------------------------------------------------------------
+// Codec
+
+func (suite *GSMSuite) Test_IsGSM(c *C) {
+	c.Assert(IsGSM("Hej på dig, Åsa! Hur mår du?"), Equals, true)
+	c.Assert(IsGSM("Pris: 10€ {inkl. moms}"), Equals, true)
+	c.Assert(IsGSM("Hej 😀"), Equals, false)
+	c.Assert(IsGSM("Ελλάδα"), Equals, false)
+}
+
+func (suite *GSMSuite) Test_EncodeGSM(c *C) {
+	septets, err := EncodeGSM("@Aå€")
+	c.Assert(err, IsNil)
+	c.Assert(septets, DeepEquals, []byte{0x00, 0x41, 0x0F, 0x1B, 0x65})
+}
+
+func (suite *GSMSuite) Test_EncodeGSM_Unsupported(c *C) {
+	_, err := EncodeGSM("ok 😀")
+	c.Assert(err, ErrorMatches, `character '😀' at position 3 is not in the GSM alphabet`)
+
+	// the position counts characters, not bytes
+	_, err = EncodeGSM("åäö 😀")
+	c.Assert(err, ErrorMatches, `character '😀' at position 4 is not in the GSM alphabet`)
+}
+
+func (suite *GSMSuite) Test_DecodeGSM(c *C) {
+	text, err := DecodeGSM([]byte{0x00, 0x41, 0x0F, 0x1B, 0x65, 0x1B, 0x3C})
+	c.Assert(err, IsNil)
+	c.Assert(text, Equals, "@Aå€[")
+}
+
+func (suite *GSMSuite) Test_DecodeGSM_Invalid(c *C) {
+	_, err := DecodeGSM([]byte{0x41, 0x80})
+	c.Assert(err, ErrorMatches, "invalid septet 0x80 at position 1")
+
+	_, err = DecodeGSM([]byte{0x41, 0x1B})
+	c.Assert(err, ErrorMatches, "escape septet at end of input")
+
+	_, err = DecodeGSM([]byte{0x1B, 0x41})
+	c.Assert(err, ErrorMatches, "invalid extension septet 0x41 at position 1")
+}
+
+func (suite *GSMSuite) Test_GSM_RoundTrip(c *C) {
+	text := ""
+	for i, r := range gsmBasic {
+		if i != gsmEscape {
+			text += string(r)
+		}
+	}
+	for _, r := range gsmExtension {
+		text += string(r)
+	}
+
+	septets, err := EncodeGSM(text)
+	c.Assert(err, IsNil)
+	decoded, err := DecodeGSM(septets)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, Equals, text)
+}
+
+// -------------------------------------------------------------
+// Transliteration
+
+func (suite *GSMSuite) Test_TransliterateGSM(c *C) {
+	c.Assert(TransliterateGSM("“Déjà vu” – façade…"), Equals, `"Déjà vu" - facade...`)
+	c.Assert(TransliterateGSM("Hej 😀"), Equals, "Hej ?")
+}
+
+// -------------------------------------------------------------
+// Message selection
+
+func (suite *GSMSuite) Test_NewMessage_Text(c *C) {
+	dest := &Destination{Recipients: []string{"0046703112233"}}
+	c.Assert(NewMessage("Hej på dig", dest, false), DeepEquals, &TextMessage{
+		Text:        "Hej på dig",
+		Destination: dest,
+	})
+}
+
+func (suite *GSMSuite) Test_NewMessage_Unicode(c *C) {
+	dest := &Destination{Recipients: []string{"0046703112233"}}
+	c.Assert(NewMessage("Hej 😀", dest, false), DeepEquals, &UnicodeMessage{
+		Text:        "Hej 😀",
+		Destination: dest,
+	})
+}
+
+func (suite *GSMSuite) Test_NewMessage_Transliterate(c *C) {
+	dest := &Destination{Recipients: []string{"0046703112233"}}
+	c.Assert(NewMessage("Hej 😀", dest, true), DeepEquals, &TextMessage{
+		Text:        "Hej ?",
+		Destination: dest,
+	})
+}
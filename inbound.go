@@ -0,0 +1,195 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// InboundMessage is a SMS sent to one of the account numbers and
+// forwarded by the gateway.
+type InboundMessage struct {
+	// Originator is the phone number of the sender
+	Originator string
+	// Destination is the number the message was sent to
+	Destination string
+	// Text is the message decoded to UTF-8
+	Text string
+	// Charset is the charset the text was forwarded in
+	Charset    Charset
+	ReceivedAt time.Time
+}
+
+// Keyword returns the first word of the text
+func (m *InboundMessage) Keyword() string {
+	fields := strings.Fields(m.Text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// ParseInboundMessage reads an incoming message from the query or form
+// parameters of a forwarding request.
+func ParseInboundMessage(r *http.Request) (*InboundMessage, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	message := &InboundMessage{
+		Originator:  strings.TrimSpace(r.Form.Get("originator")),
+		Destination: strings.TrimSpace(r.Form.Get("destination")),
+		Charset:     Charset(strings.ToUpper(strings.TrimSpace(r.Form.Get("charset")))),
+		ReceivedAt:  time.Now().UTC(),
+	}
+
+	if message.Originator == "" {
+		return nil, fmt.Errorf("inbound message has no originator")
+	}
+
+	text := r.Form.Get("text")
+	switch message.Charset {
+	case CharsetUTF8:
+		if !utf8.ValidString(text) {
+			return nil, fmt.Errorf("inbound message text is not valid UTF-8")
+		}
+		message.Text = text
+	case CharsetISO88591:
+		message.Text = decodeLatin1(text)
+	case "":
+		// guess from the content when no charset is given
+		if utf8.ValidString(text) {
+			message.Charset = CharsetUTF8
+			message.Text = text
+		} else {
+			message.Charset = CharsetISO88591
+			message.Text = decodeLatin1(text)
+		}
+	default:
+		return nil, fmt.Errorf("inbound message has unknown charset %q", message.Charset)
+	}
+
+	if ts := r.Form.Get("timestamp"); ts != "" {
+		timestamp, err := parseTimestamp(ts)
+		if err != nil {
+			return nil, fmt.Errorf("inbound message has invalid timestamp %q", ts)
+		}
+		message.ReceivedAt = timestamp
+	}
+
+	return message, nil
+}
+
+// decodeLatin1 converts ISO-8859-1 bytes to a UTF-8 string
+func decodeLatin1(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// InboundHandler handles incoming messages
+type InboundHandler interface {
+	HandleInbound(*InboundMessage) error
+}
+
+// InboundHandlerFunc is a function implementing InboundHandler
+type InboundHandlerFunc func(*InboundMessage) error
+
+// HandleInbound implements InboundHandler
+func (f InboundHandlerFunc) HandleInbound(m *InboundMessage) error { return f(m) }
+
+// InboundMessageHandler is a http.Handler receiving messages forwarded by
+// the gateway and passing them on to Handler.
+type InboundMessageHandler struct {
+	Handler InboundHandler
+}
+
+// ServeHTTP implements http.Handler
+func (h *InboundMessageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	message, err := ParseInboundMessage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.Handler != nil {
+		if err := h.Handler.HandleInbound(message); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "OK")
+}
+
+type route struct {
+	keyword string
+	pattern *regexp.Regexp
+	handler InboundHandler
+}
+
+func (r *route) match(m *InboundMessage) bool {
+	if r.pattern != nil {
+		return r.pattern.MatchString(m.Text)
+	}
+	return strings.EqualFold(r.keyword, m.Keyword())
+}
+
+// KeywordRouter dispatches incoming messages to the first handler with a
+// matching keyword or pattern, in the order they were added. Messages
+// without a match go to the default handler, or are dropped if none is set.
+type KeywordRouter struct {
+	routes   []*route
+	fallback InboundHandler
+}
+
+// Keyword adds a handler for messages where the first word matches
+// keyword, ignoring case.
+func (kr *KeywordRouter) Keyword(keyword string, h InboundHandler) {
+	kr.routes = append(kr.routes, &route{keyword: keyword, handler: h})
+}
+
+// Regexp adds a handler for messages where the text matches pattern
+func (kr *KeywordRouter) Regexp(pattern *regexp.Regexp, h InboundHandler) {
+	kr.routes = append(kr.routes, &route{pattern: pattern, handler: h})
+}
+
+// Default sets the handler for messages that match no other handler
+func (kr *KeywordRouter) Default(h InboundHandler) {
+	kr.fallback = h
+}
+
+// HandleInbound implements InboundHandler
+func (kr *KeywordRouter) HandleInbound(m *InboundMessage) error {
+	for _, r := range kr.routes {
+		if r.match(m) {
+			return r.handler.HandleInbound(m)
+		}
+	}
+
+	if kr.fallback != nil {
+		return kr.fallback.HandleInbound(m)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&InboundSuite{})
+
+type InboundSuite struct{}
+
+// -------------------------------------------------------------
+// Parsing
+
+func (suite *InboundSuite) Test_ParseInboundMessage_UTF8(c *C) {
+	r := httptest.NewRequest("GET", "/mo?originator=0046703112233&destination=0046700123456&text=Hej+p%C3%A5+dig&charset=UTF-8&timestamp=1475232000", nil)
+
+	message, err := ParseInboundMessage(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(message, DeepEquals, &InboundMessage{
+		Originator:  "0046703112233",
+		Destination: "0046700123456",
+		Text:        "Hej på dig",
+		Charset:     CharsetUTF8,
+		ReceivedAt:  time.Date(2016, 9, 30, 10, 40, 0, 0, time.UTC),
+	})
+}
+
+func (suite *InboundSuite) Test_ParseInboundMessage_Latin1(c *C) {
+	body := strings.NewReader("originator=0046703112233&text=Hej+p%E5+dig&charset=ISO-8859-1")
+	r := httptest.NewRequest("POST", "/mo", body)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	message, err := ParseInboundMessage(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(message.Text, Equals, "Hej på dig")
+	c.Assert(message.Charset, Equals, CharsetISO88591)
+}
+
+func (suite *InboundSuite) Test_ParseInboundMessage_GuessCharset(c *C) {
+	r := httptest.NewRequest("GET", "/mo?originator=0046703112233&text=%E5%E4%F6", nil)
+
+	message, err := ParseInboundMessage(r)
+
+	c.Assert(err, IsNil)
+	c.Assert(message.Text, Equals, "åäö")
+	c.Assert(message.Charset, Equals, CharsetISO88591)
+}
+
+func (suite *InboundSuite) Test_ParseInboundMessage_Invalid(c *C) {
+	for query, msg := range map[string]string{
+		"text=hello": "inbound message has no originator",
+		"originator=0046703112233&charset=UTF-8&text=%E5": "inbound message text is not valid UTF-8",
+		"originator=0046703112233&charset=KOI8-R":         `inbound message has unknown charset "KOI8-R"`,
+		"originator=0046703112233&timestamp=now":          `inbound message has invalid timestamp "now"`,
+	} {
+		r := httptest.NewRequest("GET", "/mo?"+query, nil)
+		_, err := ParseInboundMessage(r)
+		c.Assert(err, ErrorMatches, msg)
+	}
+}
+
+// -------------------------------------------------------------
+// Routing
+
+func (suite *InboundSuite) Test_KeywordRouter(c *C) {
+	handled := ""
+	handler := func(name string) InboundHandler {
+		return InboundHandlerFunc(func(m *InboundMessage) error {
+			handled = name
+			return nil
+		})
+	}
+
+	router := &KeywordRouter{}
+	router.Keyword("STOP", handler("stop"))
+	router.Regexp(regexp.MustCompile(`^\d{4}$`), handler("code"))
+	router.Default(handler("default"))
+
+	for text, name := range map[string]string{
+		"stop":          "stop",
+		"  Stop please": "stop",
+		"1234":          "code",
+		"stopp":         "default",
+		"":              "default",
+	} {
+		handled = ""
+		c.Assert(router.HandleInbound(&InboundMessage{Text: text}), IsNil)
+		c.Assert(handled, Equals, name, Commentf(text))
+	}
+}
+
+func (suite *InboundSuite) Test_KeywordRouter_NoDefault(c *C) {
+	router := &KeywordRouter{}
+	c.Assert(router.HandleInbound(&InboundMessage{Text: "hello"}), IsNil)
+}
+
+func (suite *InboundSuite) Test_InboundMessageHandler(c *C) {
+	var received *InboundMessage
+	router := &KeywordRouter{}
+	router.Default(InboundHandlerFunc(func(m *InboundMessage) error {
+		received = m
+		return nil
+	}))
+	h := &InboundMessageHandler{Handler: router}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/mo?originator=0046703112233&text=hello", nil))
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(received.Text, Equals, "hello")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/mo?text=hello", nil))
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger receives log messages from the client. Fields are given as
+// alternating keys and values, like in log/slog. Passwords and message
+// bodies are never logged.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+}
+
+// NopLogger discards all log messages, it is used by clients without a logger
+type NopLogger struct{}
+
+// Debug implements Logger
+func (NopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+// Warn implements Logger
+func (NopLogger) Warn(msg string, keyvals ...interface{}) {}
+
+// NewSlogLogger returns a Logger writing to a slog logger,
+// slog.Default() is used if l is nil
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.l.Debug(msg, keyvals...)
+}
+
+func (s *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.l.Warn(msg, keyvals...)
+}
+
+// NewLogrusLogger returns a Logger writing to a logrus logger,
+// the standard logrus logger is used if l is nil
+func NewLogrusLogger(l logrus.FieldLogger) Logger {
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+	return &logrusLogger{l}
+}
+
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+func (s *logrusLogger) Debug(msg string, keyvals ...interface{}) {
+	s.l.WithFields(logrusFields(keyvals)).Debug(msg)
+}
+
+func (s *logrusLogger) Warn(msg string, keyvals ...interface{}) {
+	s.l.WithFields(logrusFields(keyvals)).Warn(msg)
+}
+
+func logrusFields(keyvals []interface{}) logrus.Fields {
+	fields := logrus.Fields{}
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 == len(keyvals) {
+			fields[key] = nil
+			break
+		}
+		fields[key] = keyvals[i+1]
+	}
+	return fields
+}
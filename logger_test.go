@@ -0,0 +1,88 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	"github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&LoggerSuite{})
+
+type LoggerSuite struct{}
+
+// -------------------------------------------------------------
+// Adapters
+
+func (suite *LoggerSuite) Test_NewSlogLogger(c *C) {
+	buf := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	logger.Debug("sent message", "type", "text", "recipients", 2)
+
+	c.Assert(buf.String(), Matches, `.*level=DEBUG msg="sent message" type=text recipients=2\n`)
+}
+
+func (suite *LoggerSuite) Test_NewLogrusLogger(c *C) {
+	buf := &bytes.Buffer{}
+	l := logrus.New()
+	l.SetOutput(buf)
+	l.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	logger := NewLogrusLogger(l)
+	logger.Warn("endpoint failed", "endpoint", "se-1", "odd")
+
+	c.Assert(buf.String(), Equals, "level=warning msg=\"endpoint failed\" endpoint=se-1 odd=\"<nil>\"\n")
+}
+
+func (suite *LoggerSuite) Test_Client_logger_Default(c *C) {
+	client := NewClient("username", "password", "sendername")
+	c.Assert(client.logger(), Equals, Logger(NopLogger{}))
+}
+
+// -------------------------------------------------------------
+// Client
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_Logging(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703445566"},
+		},
+		Text: "secret message text",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458,ae65ab9e349a8dc2458de8c4a032fb45",
+	})
+
+	buf := &bytes.Buffer{}
+	suite.client.Logger = NewSlogLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+
+	out := buf.String()
+	c.Assert(out, Matches, `.*msg="sent message" type=text recipients=2 tracking_ids="\[de8c4a032fb45ae65ab9e349a8dc2458 ae65ab9e349a8dc2458de8c4a032fb45\]" attempts=1\n`)
+	c.Assert(strings.Contains(out, "password"), Equals, false)
+	c.Assert(strings.Contains(out, "secret"), Equals, false)
+}
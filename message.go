@@ -16,8 +16,17 @@
 package cellsynt
 
 import (
-	"net/url"
+	"encoding/hex"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Limits of Options.Validity accepted by the gateway
+const (
+	MinValidity = time.Minute
+	MaxValidity = 72 * time.Hour
 )
 
 // Message is a generic interface to all types of messages
@@ -31,6 +40,10 @@ type Options struct {
 	// Optional
 	OriginatorType OriginatorType
 	Originator     string
+
+	// Validity is how long the operator tries to deliver the message before
+	// it is discarded. It is rounded up to whole minutes.
+	Validity time.Duration
 }
 
 func (b *Options) GetParameters() map[string]string {
@@ -42,9 +55,39 @@ func (b *Options) GetParameters() map[string]string {
 		"originatortype": string(b.OriginatorType),
 		"originator":     b.Originator,
 	}
+	if b.Validity > 0 {
+		minutes := (b.Validity + time.Minute - 1) / time.Minute
+		params["validity"] = strconv.Itoa(int(minutes))
+	}
 	return clearEmpty(params)
 }
 
+func (b *Options) options() *Options { return b }
+
+// validate checks that the options are within the limits of the gateway
+func (b *Options) validate() error {
+	if b == nil || b.Validity == 0 {
+		return nil
+	}
+	if b.Validity < MinValidity || b.Validity > MaxValidity {
+		return fmt.Errorf("%w: validity must be between %s and %s, got %s", ErrInvalidParameter, MinValidity, MaxValidity, b.Validity)
+	}
+	return nil
+}
+
+// optionsMessage is implemented by messages embedding *Options
+type optionsMessage interface {
+	options() *Options
+}
+
+// messageOptions returns the options of a message, or nil
+func messageOptions(message Message) *Options {
+	if m, ok := message.(optionsMessage); ok {
+		return m.options()
+	}
+	return nil
+}
+
 // Destination contains default values that all message types share.
 // Theese values can be omitted if you want to use the client default
 type Destination struct {
@@ -64,7 +107,9 @@ func (b *Destination) Destinations() string {
 
 	phones := []string{}
 	for _, phone := range b.Recipients {
-		if strings.HasPrefix(phone, "+") {
+		if p, err := ParsePhoneNumber(phone, b.DefaultCountryCode); err == nil {
+			phone = p.international()
+		} else if strings.HasPrefix(phone, "+") {
 			phone = "00" + strings.TrimPrefix(phone, "+")
 		} else if !strings.HasPrefix(phone, "00") {
 			phone = "00" + b.DefaultCountryCode + strings.TrimLeft(phone, "0")
@@ -75,6 +120,37 @@ func (b *Destination) Destinations() string {
 	return strings.Join(phones, ",")
 }
 
+// Normalized returns the recipients in E.164 format. An
+// *InvalidRecipientsError is returned if any of them is not a valid number.
+func (b *Destination) Normalized() ([]string, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	numbers := []string{}
+	invalid := []*InvalidRecipient{}
+	for _, phone := range b.Recipients {
+		p, err := ParsePhoneNumber(phone, b.DefaultCountryCode)
+		if err != nil {
+			invalid = append(invalid, &InvalidRecipient{Recipient: phone, Err: err})
+			continue
+		}
+		numbers = append(numbers, p.E164())
+	}
+
+	if len(invalid) > 0 {
+		return nil, &InvalidRecipientsError{Recipients: invalid}
+	}
+	return numbers, nil
+}
+
+// Validate returns an *InvalidRecipientsError if any recipient is not a
+// valid phone number
+func (b *Destination) Validate() error {
+	_, err := b.Normalized()
+	return err
+}
+
 func (b *Destination) GetParameters() map[string]string {
 	if b == nil {
 		return map[string]string{}
@@ -93,8 +169,9 @@ type TextMessage struct {
 	Text string
 
 	// Optional
-	Charset     Charset
-	AllowConcat bool
+	Charset Charset
+	// AllowConcat is the maximum number of parts (1-6) the text may be split into
+	AllowConcat int
 
 	*Destination
 	*Options
@@ -107,9 +184,9 @@ func (m *TextMessage) Type() string { return "text" }
 func (m *TextMessage) GetParameters() map[string]string {
 	params := map[string]string{
 		"type":        m.Type(),
-		"text":        url.QueryEscape(m.Text),
+		"text":        m.Text,
 		"charset":     string(m.Charset),
-		"allowconcat": ternaryStr(m.AllowConcat, "6", ""),
+		"allowconcat": intStr(m.AllowConcat),
 	}
 	params = mergeParams(params, m.Destination.GetParameters())
 	params = mergeParams(params, m.Options.GetParameters())
@@ -121,9 +198,11 @@ func (m *TextMessage) GetParameters() map[string]string {
 // manufacturer's manual for further specifications on message formats available.
 // Two parameters are needed to send the binary data: udh and data.
 // Parameters can be set individually, it is not mandatory to use both, however, at least one of them
+// Data that does not fit in a single message is split into concatenated parts when sent.
 type BinaryMessage struct {
 	Binary []byte
-	UDH    []byte
+	// UDH is the user data header, starting with the header length octet
+	UDH []byte
 
 	*Destination
 	*Options
@@ -136,8 +215,8 @@ func (m *BinaryMessage) Type() string { return "binary" }
 func (m *BinaryMessage) GetParameters() map[string]string {
 	params := map[string]string{
 		"type": m.Type(),
-		"data": string(m.Binary),
-		"udh":  string(m.UDH),
+		"data": strings.ToUpper(hex.EncodeToString(m.Binary)),
+		"udh":  strings.ToUpper(hex.EncodeToString(m.UDH)),
 	}
 	params = mergeParams(params, m.Destination.GetParameters())
 	params = mergeParams(params, m.Options.GetParameters())
@@ -154,8 +233,9 @@ type FlashMessage struct {
 	Text string
 
 	// Optional
-	Charset     Charset
-	AllowConcat bool
+	Charset Charset
+	// AllowConcat is the maximum number of parts (1-6) the text may be split into
+	AllowConcat int
 
 	*Destination
 	*Options
@@ -168,9 +248,9 @@ func (m *FlashMessage) Type() string { return "flash" }
 func (m *FlashMessage) GetParameters() map[string]string {
 	params := map[string]string{
 		"type":        m.Type(),
-		"text":        url.QueryEscape(m.Text),
+		"text":        m.Text,
 		"charset":     string(m.Charset),
-		"allowconcat": ternaryStr(m.AllowConcat, "6", ""),
+		"allowconcat": intStr(m.AllowConcat),
 	}
 	params = mergeParams(params, m.Destination.GetParameters())
 	params = mergeParams(params, m.Options.GetParameters())
@@ -189,8 +269,9 @@ type UnicodeMessage struct {
 	Text string
 
 	// Optional
-	Charset     Charset
-	AllowConcat bool
+	Charset Charset
+	// AllowConcat is the maximum number of parts (1-6) the text may be split into
+	AllowConcat int
 
 	*Destination
 	*Options
@@ -203,9 +284,9 @@ func (m *UnicodeMessage) Type() string { return "unicode" }
 func (m *UnicodeMessage) GetParameters() map[string]string {
 	params := map[string]string{
 		"type":        m.Type(),
-		"text":        url.QueryEscape(m.Text),
+		"text":        m.Text,
 		"charset":     string(m.Charset),
-		"allowconcat": ternaryStr(m.AllowConcat, "6", ""),
+		"allowconcat": intStr(m.AllowConcat),
 	}
 	params = mergeParams(params, m.Destination.GetParameters())
 	params = mergeParams(params, m.Options.GetParameters())
@@ -15,7 +15,12 @@
 
 package cellsynt
 
-import . "gopkg.in/check.v1"
+import (
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
 
 var _ = Suite(&MessageSuite{})
 
@@ -82,6 +87,42 @@ func (suite *MessageSuite) Test_Options_Omitted(c *C) {
 	})
 }
 
+func (suite *MessageSuite) Test_Options_Validity(c *C) {
+	r := &Options{
+		Validity: 90 * time.Second,
+	}
+	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
+		"validity": "2",
+	})
+	c.Assert(r.validate(), IsNil)
+}
+
+func (suite *MessageSuite) Test_Options_Validity_Range(c *C) {
+	for _, validity := range []time.Duration{-time.Minute, 30 * time.Second, 73 * time.Hour} {
+		r := &Options{Validity: validity}
+		c.Assert(errors.Is(r.validate(), ErrInvalidParameter), Equals, true)
+	}
+
+	r := &Options{Validity: 30 * time.Second}
+	c.Assert(r.validate(), ErrorMatches, "invalid parameter: validity must be between 1m0s and 72h0m0s, got 30s")
+
+	var nilOptions *Options
+	c.Assert(nilOptions.validate(), IsNil)
+}
+
+func (suite *MessageSuite) Test_BinaryMessage_Validity(c *C) {
+	r := &BinaryMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Options: &Options{
+			Validity: 10 * time.Minute,
+		},
+		Binary: []byte{0x33, 0x44, 0x55, 0xFF},
+	}
+	c.Assert(r.GetParameters()["validity"], Equals, "10")
+}
+
 // -------------------------------------------------------------
 // Text message
 
@@ -92,7 +133,7 @@ func (suite *MessageSuite) Test_TextMessage_Full(c *C) {
 		},
 		Text:        "test",
 		Charset:     CharsetUTF8,
-		AllowConcat: true,
+		AllowConcat: 6,
 		Options: &Options{
 			OriginatorType: OriginatorTypeAlpha,
 			Originator:     "test",
@@ -119,7 +160,7 @@ func (suite *MessageSuite) Test_TextMessage_Minimal(c *C) {
 	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
 		"destination": "0046703112233",
 		"type":        "text",
-		"text":        "test+%C3%A5%C3%A4%C3%B6",
+		"text":        "test åäö",
 	})
 }
 
@@ -135,15 +176,15 @@ func (suite *MessageSuite) Test_BinaryMessage_Normal(c *C) {
 			OriginatorType: OriginatorTypeAlpha,
 			Originator:     "test",
 		},
-		UDH:    []byte("AABBCC001122"),
-		Binary: []byte("334455FF"),
+		UDH:    []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0},
+		Binary: []byte{0x33, 0x44, 0x55, 0xFF},
 	}
 	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
 		"destination":    "0046703112233",
 		"type":           "binary",
 		"originatortype": "alpha",
 		"originator":     "test",
-		"udh":            "AABBCC001122",
+		"udh":            "0605040B8423F0",
 		"data":           "334455FF",
 	})
 }
@@ -154,7 +195,7 @@ func (suite *MessageSuite) Test_BinaryMessage_Minimal(c *C) {
 			Recipients: []string{"0046703112233"},
 		},
 
-		Binary: []byte("334455FF"),
+		Binary: []byte{0x33, 0x44, 0x55, 0xFF},
 	}
 	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
 		"destination": "0046703112233",
@@ -177,7 +218,7 @@ func (suite *MessageSuite) Test_FlashMessage_Normal(c *C) {
 		},
 		Text:        "test",
 		Charset:     CharsetUTF8,
-		AllowConcat: true,
+		AllowConcat: 6,
 	}
 	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
 		"destination":    "0046703112233",
@@ -217,7 +258,7 @@ func (suite *MessageSuite) Test_UnicodeMessage_Normal(c *C) {
 			Originator:     "test",
 		},
 		Charset:     CharsetUTF8,
-		AllowConcat: true,
+		AllowConcat: 6,
 		Text:        "Ελλάδα",
 	}
 	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
@@ -226,7 +267,7 @@ func (suite *MessageSuite) Test_UnicodeMessage_Normal(c *C) {
 		"originatortype": "alpha",
 		"originator":     "test",
 		"allowconcat":    "6",
-		"text":           "%CE%95%CE%BB%CE%BB%CE%AC%CE%B4%CE%B1",
+		"text":           "Ελλάδα",
 		"charset":        "UTF-8",
 	})
 }
@@ -242,6 +283,6 @@ func (suite *MessageSuite) Test_UnicodeMessage_Minimal(c *C) {
 	c.Assert(r.GetParameters(), DeepEquals, map[string]string{
 		"destination": "0046703112233",
 		"type":        "unicode",
-		"text":        "%CE%95%CE%BB%CE%BB%CE%AC%CE%B4%CE%B1",
+		"text":        "Ελλάδα",
 	})
 }
@@ -0,0 +1,284 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names reported by the client
+const (
+	// MetricMessages counts messages, labeled with type, outcome,
+	// error and segments
+	MetricMessages = "cellsynt_messages_total"
+	// MetricSendDuration is the time in seconds spent sending a message,
+	// including retries, labeled with type and outcome
+	MetricSendDuration = "cellsynt_send_duration_seconds"
+	// MetricRequestDuration is the latency in seconds of a single gateway
+	// request, labeled with type and outcome
+	MetricRequestDuration = "cellsynt_request_duration_seconds"
+)
+
+// Outcome label values
+const (
+	OutcomeSent   = "sent"
+	OutcomeFailed = "failed"
+)
+
+// Labels are the dimensions of a metric
+type Labels map[string]string
+
+// Metrics receives counters and histogram observations from the client
+type Metrics interface {
+	// Counter adds value to the counter with the given name and labels
+	Counter(name string, value float64, labels Labels)
+	// Histogram records an observation for the histogram with the given
+	// name and labels
+	Histogram(name string, value float64, labels Labels)
+}
+
+// observeSend reports a finished call to SendMessage
+func (c *Client) observeSend(message Message, err error, duration time.Duration) {
+	if c.Metrics == nil {
+		return
+	}
+
+	outcome := outcomeLabel(err)
+	c.Metrics.Counter(MetricMessages, 1, Labels{
+		"type":     message.Type(),
+		"outcome":  outcome,
+		"error":    errorCategory(err),
+		"segments": strconv.Itoa(messageSegments(message)),
+	})
+	c.Metrics.Histogram(MetricSendDuration, duration.Seconds(), Labels{
+		"type":    message.Type(),
+		"outcome": outcome,
+	})
+}
+
+// observeRequest reports the latency of a single gateway request
+func (c *Client) observeRequest(message Message, err error, duration time.Duration) {
+	if c.Metrics == nil {
+		return
+	}
+
+	c.Metrics.Histogram(MetricRequestDuration, duration.Seconds(), Labels{
+		"type":    message.Type(),
+		"outcome": outcomeLabel(err),
+	})
+}
+
+func outcomeLabel(err error) string {
+	if err != nil {
+		return OutcomeFailed
+	}
+	return OutcomeSent
+}
+
+// messageSegments returns the number of parts a message is sent as
+func messageSegments(message Message) int {
+	if s, ok := message.(Segmenter); ok {
+		return s.Segments().Segments
+	}
+	return 1
+}
+
+// errorCodes are the gateway error codes in the order errors are matched
+// against them
+var errorCodes = []ErrorCode{
+	ErrorCodeAuthentication,
+	ErrorCodeInvalidDestination,
+	ErrorCodeInvalidOriginator,
+	ErrorCodeInvalidParameter,
+	ErrorCodeInsufficientCredit,
+	ErrorCodeServer,
+	ErrorCodeUnexpectedResponse,
+	ErrorCodeGateway,
+}
+
+// errorCategory returns a short label describing an error, or an empty
+// string if err is nil
+func errorCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, code := range errorCodes {
+		if errors.Is(err, errorSentinels[code]) {
+			return string(code)
+		}
+	}
+
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrExceedsBurst):
+		return "exceeds_burst"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrMessageTooLong):
+		return "message_too_long"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+
+	switch retryClass(err) {
+	case RetryConnection:
+		return "connection"
+	case RetryNetwork:
+		return "network"
+	}
+	return "other"
+}
+
+// DefaultBuckets are the histogram upper bounds used by ExpvarMetrics
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ExpvarMetrics publishes metrics with the expvar package, making them
+// available on /debug/vars. Each series is named after the metric and its
+// labels, like cellsynt_messages_total{outcome="sent",type="text"}.
+type ExpvarMetrics struct {
+	// Buckets are the histogram upper bounds, DefaultBuckets if nil
+	Buckets []float64
+
+	mu         sync.Mutex
+	counters   *expvar.Map
+	histograms *expvar.Map
+}
+
+// NewExpvarMetrics publishes a new expvar map with the given name. Like
+// expvar.Publish it panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := newExpvarMetrics()
+	expvar.Publish(name, m.root())
+	return m
+}
+
+func newExpvarMetrics() *ExpvarMetrics {
+	return &ExpvarMetrics{
+		counters:   new(expvar.Map).Init(),
+		histograms: new(expvar.Map).Init(),
+	}
+}
+
+// root returns the map published by NewExpvarMetrics
+func (m *ExpvarMetrics) root() *expvar.Map {
+	root := new(expvar.Map).Init()
+	root.Set("counters", m.counters)
+	root.Set("histograms", m.histograms)
+	return root
+}
+
+// Counter implements Metrics
+func (m *ExpvarMetrics) Counter(name string, value float64, labels Labels) {
+	m.counters.AddFloat(seriesName(name, labels), value)
+}
+
+// Histogram implements Metrics
+func (m *ExpvarMetrics) Histogram(name string, value float64, labels Labels) {
+	series := seriesName(name, labels)
+
+	m.mu.Lock()
+	h, ok := m.histograms.Get(series).(*expvarHistogram)
+	if !ok {
+		buckets := m.Buckets
+		if buckets == nil {
+			buckets = DefaultBuckets
+		}
+		h = newExpvarHistogram(buckets)
+		m.histograms.Set(series, h)
+	}
+	m.mu.Unlock()
+
+	h.observe(value)
+}
+
+// seriesName formats a metric name with its labels sorted by key
+func seriesName(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + strconv.Quote(labels[k])
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+// expvarHistogram counts observations in cumulative buckets
+type expvarHistogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newExpvarHistogram(buckets []float64) *expvarHistogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &expvarHistogram{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)),
+	}
+}
+
+func (h *expvarHistogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+	h.sum += value
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// String implements expvar.Var
+func (h *expvarHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := map[string]uint64{}
+	for i, bound := range h.buckets {
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = h.counts[i]
+	}
+
+	b, _ := json.Marshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{h.count, h.sum, buckets})
+	return string(b)
+}
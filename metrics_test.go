@@ -0,0 +1,180 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"sync"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&MetricsSuite{})
+
+type MetricsSuite struct{}
+
+type observation struct {
+	name   string
+	value  float64
+	labels Labels
+}
+
+// recordingMetrics keeps all counters and observations it receives
+type recordingMetrics struct {
+	mu           sync.Mutex
+	counters     []observation
+	observations []observation
+}
+
+func (m *recordingMetrics) Counter(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = append(m.counters, observation{name, value, labels})
+}
+
+func (m *recordingMetrics) Histogram(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, observation{name, value, labels})
+}
+
+// -------------------------------------------------------------
+// Labels
+
+func (suite *MetricsSuite) Test_errorCategory(c *C) {
+	tests := []struct {
+		err      error
+		category string
+	}{
+		{nil, ""},
+		{&Error{Code: ErrorCodeInsufficientCredit}, "insufficient_credit"},
+		{fmt.Errorf("validity: %w", ErrInvalidParameter), "invalid_parameter"},
+		{ErrRateLimited, "rate_limited"},
+		{fmt.Errorf("%w: needs 6 tokens", ErrExceedsBurst), "exceeds_burst"},
+		{&CircuitOpenError{}, "circuit_open"},
+		{fmt.Errorf("text: %w", ErrMessageTooLong), "message_too_long"},
+		{&InvalidRecipientsError{Recipients: []*InvalidRecipient{{Recipient: "0703112233", Err: ErrMissingCountryCode}}}, "invalid_destination"},
+		{context.Canceled, "canceled"},
+		{context.DeadlineExceeded, "timeout"},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, "connection"},
+		{errors.New("something"), "other"},
+	}
+
+	for _, test := range tests {
+		c.Check(errorCategory(test.err), Equals, test.category, Commentf("%v", test.err))
+	}
+}
+
+func (suite *MetricsSuite) Test_seriesName(c *C) {
+	c.Assert(seriesName("requests", nil), Equals, "requests")
+	c.Assert(seriesName("requests", Labels{"type": "text", "outcome": "sent"}), Equals,
+		`requests{outcome="sent",type="text"}`)
+}
+
+// -------------------------------------------------------------
+// Expvar
+
+func (suite *MetricsSuite) Test_ExpvarMetrics(c *C) {
+	m := newExpvarMetrics()
+	m.Buckets = []float64{1, 0.1}
+
+	m.Counter("messages", 1, Labels{"type": "text"})
+	m.Counter("messages", 2, Labels{"type": "text"})
+	m.Histogram("latency", 0.05, nil)
+	m.Histogram("latency", 0.5, nil)
+	m.Histogram("latency", 5, nil)
+
+	root := m.root()
+	counters := root.Get("counters").(*expvar.Map)
+	histograms := root.Get("histograms").(*expvar.Map)
+
+	c.Assert(counters.Get(`messages{type="text"}`).String(), Equals, "3")
+	c.Assert(histograms.Get("latency").String(), Equals,
+		`{"count":3,"sum":5.55,"buckets":{"0.1":1,"1":2}}`)
+}
+
+// -------------------------------------------------------------
+// Client
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_Metrics(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	metrics := &recordingMetrics{}
+	suite.client.Metrics = metrics
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+
+	c.Assert(metrics.counters, HasLen, 1)
+	c.Assert(metrics.counters[0].name, Equals, MetricMessages)
+	c.Assert(metrics.counters[0].value, Equals, 1.0)
+	c.Assert(metrics.counters[0].labels, DeepEquals, Labels{
+		"type":     "text",
+		"outcome":  OutcomeSent,
+		"error":    "",
+		"segments": "1",
+	})
+
+	c.Assert(metrics.observations, HasLen, 2)
+	c.Assert(metrics.observations[0].name, Equals, MetricRequestDuration)
+	c.Assert(metrics.observations[1].name, Equals, MetricSendDuration)
+	c.Assert(metrics.observations[1].labels, DeepEquals, Labels{
+		"type":    "text",
+		"outcome": OutcomeSent,
+	})
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_MetricsFailure(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Not enough credits",
+	})
+
+	metrics := &recordingMetrics{}
+	suite.client.Metrics = metrics
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, NotNil)
+
+	c.Assert(metrics.counters, HasLen, 1)
+	c.Assert(metrics.counters[0].labels["outcome"], Equals, OutcomeFailed)
+	c.Assert(metrics.counters[0].labels["error"], Equals, "insufficient_credit")
+	c.Assert(metrics.observations[0].labels["outcome"], Equals, OutcomeFailed)
+}
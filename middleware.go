@@ -0,0 +1,62 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Request is a message on its way to the gateway, passed through the
+// middleware of a client
+type Request struct {
+	// Message is the message being sent. It is read only, the message has
+	// already been built into Params; change Params to change what is sent.
+	Message Message
+	// Params are the form parameters posted to the gateway. The recipients
+	// are validated again after the middleware has run.
+	Params map[string]string
+	// Header is added to the HTTP request
+	Header http.Header
+}
+
+// SendFunc sends a request to the gateway
+type SendFunc func(ctx context.Context, req *Request) (*Response, error)
+
+// Middleware wraps a SendFunc. It can inspect or modify the request before
+// calling next, inspect the response after, or return without calling next
+// to stop the request from being sent.
+type Middleware func(next SendFunc) SendFunc
+
+// handler returns the send pipeline wrapped in the client middleware
+func (c *Client) handler() SendFunc {
+	h := SendFunc(c.sendRequest)
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		h = c.Middleware[i](h)
+	}
+	return h
+}
+
+// validate checks the recipients of a request, as middleware may have
+// changed them after the message was validated
+func (r *Request) validate() error {
+	recipients := r.recipients()
+	if len(recipients) == 0 {
+		return fmt.Errorf("message has no destination set")
+	}
+	return (&Destination{Recipients: recipients}).Validate()
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+// -------------------------------------------------------------
+// Middleware
+
+func (suite *CellsyntSuite) Test_Client_Middleware_Order(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	calls := []string{}
+	record := func(name string) Middleware {
+		return func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				calls = append(calls, name+" before")
+				response, err := next(ctx, req)
+				calls = append(calls, name+" after")
+				return response, err
+			}
+		}
+	}
+	suite.client.Middleware = []Middleware{record("outer"), record("inner")}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+	c.Assert(calls, DeepEquals, []string{"outer before", "inner before", "inner after", "outer after"})
+}
+
+func (suite *CellsyntSuite) Test_Client_Middleware_ModifyRequest(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		CheckFn: func(r *http.Request, body string) {
+			c.Assert(r.Header.Get("X-Request-Id"), Equals, "abc123")
+			c.Assert(r.Header.Get("Content-Type"), Equals, "application/x-www-form-urlencoded")
+			c.Assert(body, Equals, "charset=UTF-8&destination=0046703112233&originator=override&originatortype=alpha&password=password&text=test&type=text&username=username")
+		},
+	})
+
+	suite.client.Middleware = []Middleware{
+		func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				req.Header.Set("X-Request-Id", "abc123")
+				req.Params["originator"] = "override"
+				return next(ctx, req)
+			}
+		},
+	}
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+}
+
+func (suite *CellsyntSuite) Test_Client_Middleware_InvalidRecipients(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	destination := ""
+	suite.client.Middleware = []Middleware{
+		func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				req.Params["destination"] = destination
+				return next(ctx, req)
+			}
+		},
+	}
+
+	// recipients changed by middleware are validated, no request is made
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, ErrorMatches, "message has no destination set")
+
+	destination = "0046703112233,0703445566"
+	_, err = suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrInvalidDestination), Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Client_Middleware_ShortCircuit(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	errNotAllowed := errors.New("recipient not allowed")
+	suite.client.Middleware = []Middleware{
+		func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				if req.Params["destination"] != "0046700000000" {
+					return nil, errNotAllowed
+				}
+				return next(ctx, req)
+			}
+		},
+	}
+
+	// no request is made to the mock server
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, Equals, errNotAllowed)
+}
+
+func (suite *CellsyntSuite) Test_Client_Middleware_Response(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.client.Middleware = []Middleware{
+		func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				return &Response{Success: true, TrackingIDs: []string{"local"}}, nil
+			}
+		},
+	}
+
+	response, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+	c.Assert(response.TrackingIDs, DeepEquals, []string{"local"})
+}
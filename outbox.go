@@ -0,0 +1,348 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OutboxStatus is the state of a message in the outbox
+type OutboxStatus string
+
+const (
+	OutboxPending  OutboxStatus = "pending"
+	OutboxSending  OutboxStatus = "sending"
+	OutboxSent     OutboxStatus = "sent"
+	OutboxFailed   OutboxStatus = "failed"
+	OutboxCanceled OutboxStatus = "canceled"
+)
+
+// final reports if no more attempts are made for an item with the status
+func (s OutboxStatus) final() bool {
+	return s == OutboxSent || s == OutboxFailed || s == OutboxCanceled
+}
+
+// Default values used for unset Outbox fields
+const (
+	DefaultOutboxPollInterval = time.Second
+)
+
+// DefaultOutboxRetry is used by an Outbox without a retry policy
+var DefaultOutboxRetry = RetryPolicy{
+	MaxAttempts:    10,
+	InitialBackoff: 30 * time.Second,
+	MaxBackoff:     time.Hour,
+	Jitter:         0.2,
+}
+
+// OutboxItem is a message in the outbox and its delivery state
+type OutboxItem struct {
+	// ID is the local id of the message
+	ID          string
+	MessageType string
+	Message     json.RawMessage
+	Status      OutboxStatus
+
+	// Attempts is the number of times sending has failed or succeeded
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	TrackingIDs []string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (item *OutboxItem) copy() *OutboxItem {
+	c := *item
+	c.TrackingIDs = append([]string(nil), item.TrackingIDs...)
+	return &c
+}
+
+// encodeMessage serializes a message to be stored in an outbox item
+func encodeMessage(message Message) (json.RawMessage, error) {
+	switch message.(type) {
+	case *TextMessage, *FlashMessage, *UnicodeMessage, *BinaryMessage, *WAPPushMessage:
+		return json.Marshal(message)
+	}
+	return nil, fmt.Errorf("can not store %s message", message.Type())
+}
+
+// decodeMessage restores a message stored by encodeMessage
+func decodeMessage(messageType string, data json.RawMessage) (Message, error) {
+	var message Message
+	switch messageType {
+	case "text":
+		message = &TextMessage{}
+	case "flash":
+		message = &FlashMessage{}
+	case "unicode":
+		message = &UnicodeMessage{}
+	case "binary":
+		message = &BinaryMessage{}
+	case "wappush":
+		message = &WAPPushMessage{}
+	default:
+		return nil, fmt.Errorf("unknown message type %q", messageType)
+	}
+
+	if err := json.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Outbox stores messages in a queue and sends them in the background.
+// Messages that fail with a retryable error are tried again later.
+type Outbox struct {
+	Client *Client
+	Queue  Queue
+
+	// Workers is the number of messages sent in parallel, at least 1
+	Workers int
+	// Retry controls how failed messages are retried, DefaultOutboxRetry if nil
+	Retry *RetryPolicy
+	// PollInterval is how often the queue is checked for messages to send
+	PollInterval time.Duration
+
+	wakeOnce sync.Once
+	wake     chan struct{}
+}
+
+// NewOutbox returns an outbox sending messages from queue through client
+func NewOutbox(client *Client, queue Queue) *Outbox {
+	return &Outbox{
+		Client: client,
+		Queue:  queue,
+	}
+}
+
+func (o *Outbox) wakeChan() chan struct{} {
+	o.wakeOnce.Do(func() {
+		o.wake = make(chan struct{}, 1)
+	})
+	return o.wake
+}
+
+// notify wakes a waiting worker
+func (o *Outbox) notify() {
+	select {
+	case o.wakeChan() <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) pollInterval() time.Duration {
+	if o.PollInterval > 0 {
+		return o.PollInterval
+	}
+	return DefaultOutboxPollInterval
+}
+
+func (o *Outbox) retry() *RetryPolicy {
+	if o.Retry != nil {
+		return o.Retry
+	}
+	return &DefaultOutboxRetry
+}
+
+// Enqueue stores a message to be sent and returns its local id
+func (o *Outbox) Enqueue(message Message) (string, error) {
+	return o.add(message, time.Now())
+}
+
+// add stores a message to be sent at a time
+func (o *Outbox) add(message Message, at time.Time) (string, error) {
+	if messageDestination(message) == nil || message.Destinations() == "" {
+		return "", fmt.Errorf("message has no destination set")
+	}
+
+	data, err := encodeMessage(message)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	item := &OutboxItem{
+		ID:          randomID(),
+		MessageType: message.Type(),
+		Message:     data,
+		Status:      OutboxPending,
+		NextAttempt: at,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := o.Queue.Put(item); err != nil {
+		return "", err
+	}
+
+	o.notify()
+	return item.ID, nil
+}
+
+// Status returns the item with a local message id
+func (o *Outbox) Status(id string) (*OutboxItem, error) {
+	return o.Queue.Get(id)
+}
+
+// Run sends queued messages until the context is canceled. If a worker
+// fails, like when the queue can not be written, the other workers are
+// stopped and the error is returned.
+func (o *Outbox) Run(ctx context.Context) error {
+	workers := o.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := o.work(workCtx); err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+func (o *Outbox) work(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		item, err := o.Queue.Claim(time.Now())
+		if err != nil {
+			return err
+		}
+
+		if item != nil {
+			if err := o.send(ctx, item); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-o.wakeChan():
+		case <-time.After(o.pollInterval()):
+		}
+	}
+}
+
+// send sends a claimed item and stores the outcome
+func (o *Outbox) send(ctx context.Context, item *OutboxItem) error {
+	message, err := decodeMessage(item.MessageType, item.Message)
+	if err != nil {
+		item.Status = OutboxFailed
+		item.LastError = err.Error()
+		item.UpdatedAt = time.Now()
+		return o.Queue.Put(item)
+	}
+
+	response, err := o.Client.SendMessageContext(ctx, message)
+	item.UpdatedAt = time.Now()
+
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) && !requestMade(err) {
+		// stopped before sending, try again when started next time
+		item.Status = OutboxPending
+		return o.Queue.Put(item)
+	}
+
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		// not sent, try again when the breaker lets a probe through
+		wait := openErr.RetryAfter
+		if wait < o.pollInterval() {
+			wait = o.pollInterval()
+		}
+		item.Status = OutboxPending
+		item.NextAttempt = item.UpdatedAt.Add(wait)
+		return o.Queue.Put(item)
+	}
+	if errors.Is(err, ErrRateLimited) {
+		// not sent, try again at the next poll
+		item.Status = OutboxPending
+		item.NextAttempt = item.UpdatedAt.Add(o.pollInterval())
+		return o.Queue.Put(item)
+	}
+
+	item.Attempts++
+	if err == nil {
+		item.Status = OutboxSent
+		item.TrackingIDs = response.TrackingIDs
+		item.LastError = ""
+		return o.Queue.Put(item)
+	}
+
+	item.LastError = err.Error()
+
+	var partialErr *PartialSendError
+	if errors.As(err, &partialErr) {
+		item.TrackingIDs = partialErr.TrackingIDs
+	}
+
+	retry := o.retry()
+	if retry.shouldRetry(item.Attempts, err) {
+		item.Status = OutboxPending
+		item.NextAttempt = item.UpdatedAt.Add(retry.backoff(item.Attempts))
+	} else {
+		item.Status = OutboxFailed
+	}
+
+	o.Client.logger().Debug("outbox message failed",
+		"id", item.ID,
+		"type", item.MessageType,
+		"attempts", item.Attempts,
+		"status", item.Status,
+		"error", item.LastError,
+	)
+
+	return o.Queue.Put(item)
+}
+
+// requestMade reports if a failed send may have reached the gateway. A
+// message stopped while its request was made may have been accepted, and
+// is not sent again.
+func requestMade(err error) bool {
+	var partialErr *PartialSendError
+	if errors.As(err, &partialErr) {
+		return true
+	}
+	var sendErr *SendError
+	return !errors.As(err, &sendErr) || sendErr.Attempts > 0
+}
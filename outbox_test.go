@@ -0,0 +1,416 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+// runOutbox starts the outbox and returns a function stopping it
+func runOutbox(c *C, outbox *Outbox) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- outbox.Run(ctx) }()
+
+	return func() {
+		cancel()
+		c.Assert(<-done, Equals, context.Canceled)
+	}
+}
+
+// failingQueue fails to store items once they have been sent
+type failingQueue struct {
+	*MemoryQueue
+}
+
+func (q *failingQueue) Put(item *OutboxItem) error {
+	if item.Status != OutboxPending {
+		return errors.New("disk full")
+	}
+	return q.MemoryQueue.Put(item)
+}
+
+// waitStatus waits until the item has a final status
+func waitStatus(c *C, outbox *Outbox, id string) *OutboxItem {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		item, err := outbox.Status(id)
+		c.Assert(err, IsNil)
+		if item.Status.final() {
+			return item
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Fatalf("outbox item %s was not sent", id)
+	return nil
+}
+
+// -------------------------------------------------------------
+// Message encoding
+
+func (suite *CellsyntSuite) Test_encodeMessage_RoundTrip(c *C) {
+	messages := []Message{
+		&TextMessage{
+			Destination: &Destination{Recipients: []string{"0046703112233"}},
+			Options:     &Options{Originator: "test"},
+			Text:        "test",
+			AllowConcat: 2,
+		},
+		&FlashMessage{Destination: &Destination{Recipients: []string{"0046703112233"}}, Text: "test"},
+		&UnicodeMessage{Destination: &Destination{Recipients: []string{"0046703112233"}}, Text: "Ελλάδα"},
+		&BinaryMessage{Destination: &Destination{Recipients: []string{"0046703112233"}}, Binary: []byte{0, 1, 2}},
+	}
+
+	for _, m := range messages {
+		data, err := encodeMessage(m)
+		c.Assert(err, IsNil)
+		decoded, err := decodeMessage(m.Type(), data)
+		c.Assert(err, IsNil)
+		c.Assert(decoded, DeepEquals, m)
+	}
+
+	_, err := decodeMessage("mms", nil)
+	c.Assert(err, ErrorMatches, `unknown message type "mms"`)
+}
+
+// -------------------------------------------------------------
+// Outbox
+
+func (suite *CellsyntSuite) Test_Outbox_Send(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxSent)
+	c.Assert(item.Attempts, Equals, 1)
+	c.Assert(item.TrackingIDs, DeepEquals, []string{"de8c4a032fb45ae65ab9e349a8dc2458"})
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Retry(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}
+	outbox.PollInterval = 5 * time.Millisecond
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxSent)
+	c.Assert(item.Attempts, Equals, 2)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_CircuitOpen(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	suite.client.Breaker = NewCircuitBreaker(1, 20*time.Millisecond)
+	suite.client.Breaker.record(false, errTestServer)
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.PollInterval = 5 * time.Millisecond
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	// the message waits for the breaker without using an attempt
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxSent)
+	c.Assert(item.Attempts, Equals, 1)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_CircuitOpen_PollInterval(c *C) {
+	suite.client.Breaker = NewCircuitBreaker(1, time.Second)
+	suite.client.Breaker.record(false, errTestServer)
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.PollInterval = time.Minute
+
+	_, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item, err := outbox.Queue.Claim(time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(outbox.send(context.Background(), item), IsNil)
+
+	// waits at least a poll interval, even if the breaker opens for less
+	c.Assert(item.Status, Equals, OutboxPending)
+	c.Assert(item.NextAttempt.Sub(item.UpdatedAt), Equals, time.Minute)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_RateLimited(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	suite.client.RateLimiter = NewRateLimiter(20, 1)
+	suite.client.RateLimiter.FailFast = true
+	c.Assert(suite.client.RateLimiter.Wait(context.Background(), "", 1), IsNil)
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.PollInterval = 5 * time.Millisecond
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxSent)
+	c.Assert(item.Attempts, Equals, 1)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_RateLimited_PollInterval(c *C) {
+	suite.client.RateLimiter = NewRateLimiter(0.001, 1)
+	suite.client.RateLimiter.FailFast = true
+	c.Assert(suite.client.RateLimiter.Wait(context.Background(), "", 1), IsNil)
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.PollInterval = time.Minute
+
+	_, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item, err := outbox.Queue.Claim(time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(outbox.send(context.Background(), item), IsNil)
+
+	c.Assert(item.Status, Equals, OutboxPending)
+	c.Assert(item.Attempts, Equals, 0)
+	c.Assert(item.NextAttempt.Sub(item.UpdatedAt), Equals, time.Minute)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_CanceledWaiting(c *C) {
+	suite.client.RateLimiter = NewRateLimiter(0.001, 1)
+	c.Assert(suite.client.RateLimiter.Wait(context.Background(), "", 1), IsNil)
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+
+	_, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item, err := outbox.Queue.Claim(time.Now())
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(outbox.send(ctx, item), IsNil)
+
+	// never sent, so it is sent when the outbox is started again
+	c.Assert(item.Status, Equals, OutboxPending)
+	c.Assert(item.Attempts, Equals, 0)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_CanceledSending(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	suite.client.HTTPClient = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			// stopped after the gateway got the request
+			cancel()
+			return nil, context.Canceled
+		}),
+	}
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+
+	_, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item, err := outbox.Queue.Claim(time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(outbox.send(ctx, item), IsNil)
+
+	// the message may have been accepted, it is not sent again
+	c.Assert(item.Status, Equals, OutboxFailed)
+	c.Assert(item.Attempts, Equals, 1)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_PartialSend(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   503,
+		Body:   "Service Unavailable",
+	})
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}
+	outbox.PollInterval = 5 * time.Millisecond
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.Enqueue(&BinaryMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Binary:      make([]byte, 200),
+	})
+	c.Assert(err, IsNil)
+
+	// the accepted part is never sent again
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxFailed)
+	c.Assert(item.Attempts, Equals, 1)
+	c.Assert(item.TrackingIDs, DeepEquals, []string{"de8c4a032fb45ae65ab9e349a8dc2458"})
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Failed(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "Error: Not enough credits",
+	})
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxFailed)
+	c.Assert(item.Attempts, Equals, 1)
+	c.Assert(item.LastError, Equals, "Not enough credits")
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Run_QueueError(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	outbox := NewOutbox(suite.client, &failingQueue{NewMemoryQueue()})
+	outbox.Workers = 3
+
+	_, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	done := make(chan error)
+	go func() { done <- outbox.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		c.Assert(err, ErrorMatches, "disk full")
+	case <-time.After(5 * time.Second):
+		c.Fatal("Run did not return after a queue error")
+	}
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Run_Canceled(c *C) {
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.Workers = 3
+
+	id, err := outbox.Enqueue(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	})
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error)
+	go func() { done <- outbox.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		c.Assert(err, Equals, context.Canceled)
+	case <-time.After(5 * time.Second):
+		c.Fatal("Run did not return after the context was canceled")
+	}
+
+	item, err := outbox.Status(id)
+	c.Assert(err, IsNil)
+	c.Assert(item.Status, Equals, OutboxPending)
+	c.Assert(item.Attempts, Equals, 0)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Enqueue_NoDestination(c *C) {
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	_, err := outbox.Enqueue(&TextMessage{Text: "test"})
+	c.Assert(err, ErrorMatches, "message has no destination set")
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMissingCountryCode is returned for national numbers when neither the
+// destination nor the client has a default country code
+var ErrMissingCountryCode = errors.New("national number has no country code")
+
+// countryRule describes the national numbering plan of a country
+type countryRule struct {
+	// trunkPrefix is dialed before national numbers within the country
+	trunkPrefix string
+	// minLength and maxLength limit the national significant number
+	minLength, maxLength int
+}
+
+// countryRules are keyed by country calling code
+var countryRules = map[string]countryRule{
+	"1":   {"1", 10, 10},
+	"7":   {"8", 10, 10},
+	"31":  {"0", 9, 9},
+	"33":  {"0", 9, 9},
+	"34":  {"", 9, 9},
+	"39":  {"", 6, 11},
+	"41":  {"0", 9, 9},
+	"43":  {"0", 4, 13},
+	"44":  {"0", 9, 10},
+	"45":  {"", 8, 8},
+	"46":  {"0", 7, 9},
+	"47":  {"", 8, 8},
+	"48":  {"", 9, 9},
+	"49":  {"0", 6, 11},
+	"353": {"0", 7, 9},
+	"354": {"", 7, 9},
+	"358": {"0", 5, 12},
+	"370": {"8", 8, 8},
+	"371": {"", 8, 8},
+	"372": {"", 7, 8},
+}
+
+// Length limits for numbers in countries without a rule
+const (
+	minNationalLength = 4
+	maxE164Length     = 15
+)
+
+// PhoneNumber is a phone number split into country code and national
+// significant number
+type PhoneNumber struct {
+	// CountryCode is empty if the country of an international number is not known
+	CountryCode string
+	National    string
+}
+
+// E164 returns the number in E.164 format, like +46703112233
+func (p PhoneNumber) E164() string {
+	return "+" + p.CountryCode + p.National
+}
+
+// String implements fmt.Stringer
+func (p PhoneNumber) String() string {
+	return p.E164()
+}
+
+// international returns the number in the format expected by the gateway
+func (p PhoneNumber) international() string {
+	return "00" + p.CountryCode + p.National
+}
+
+// ParsePhoneNumber parses a phone number written in international format,
+// starting with + or 00, or in national format if a country code is given.
+// Spaces, dashes, dots, slashes and parentheses are ignored.
+func ParsePhoneNumber(number, defaultCountryCode string) (PhoneNumber, error) {
+	digits, international, err := cleanPhoneNumber(number)
+	if err != nil {
+		return PhoneNumber{}, err
+	}
+
+	if international {
+		return parseInternational(digits)
+	}
+
+	if defaultCountryCode == "" {
+		return PhoneNumber{}, ErrMissingCountryCode
+	}
+
+	rule, ok := countryRules[defaultCountryCode]
+	if !ok {
+		return checkLength(PhoneNumber{
+			CountryCode: defaultCountryCode,
+			National:    strings.TrimLeft(digits, "0"),
+		})
+	}
+
+	p := PhoneNumber{
+		CountryCode: defaultCountryCode,
+		National:    strings.TrimPrefix(digits, rule.trunkPrefix),
+	}
+	return checkLength(p)
+}
+
+// cleanPhoneNumber strips formatting characters and the international
+// prefix, and returns the remaining digits.
+func cleanPhoneNumber(number string) (digits string, international bool, err error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case strings.ContainsRune(" -./() ", r):
+		default:
+			return "", false, fmt.Errorf("invalid character %q", r)
+		}
+	}
+
+	digits = b.String()
+	if !international && strings.HasPrefix(digits, "00") {
+		digits = strings.TrimPrefix(digits, "00")
+		international = true
+	}
+	if digits == "" {
+		return "", false, fmt.Errorf("number has no digits")
+	}
+	return digits, international, nil
+}
+
+// parseInternational splits digits following an international prefix into
+// country code and national number
+func parseInternational(digits string) (PhoneNumber, error) {
+	for n := 1; n <= 3 && n < len(digits); n++ {
+		cc := digits[:n]
+		rule, ok := countryRules[cc]
+		if !ok {
+			continue
+		}
+
+		national := digits[n:]
+		// numbers are often written with the trunk prefix, like +46 (0)70
+		trimmed := strings.TrimPrefix(national, rule.trunkPrefix)
+		if rule.trunkPrefix != "" && len(national) > rule.maxLength && len(trimmed) >= rule.minLength {
+			national = trimmed
+		}
+		return checkLength(PhoneNumber{CountryCode: cc, National: national})
+	}
+
+	return checkLength(PhoneNumber{National: digits})
+}
+
+func checkLength(p PhoneNumber) (PhoneNumber, error) {
+	minLength, maxLength := minNationalLength, maxE164Length-len(p.CountryCode)
+	if rule, ok := countryRules[p.CountryCode]; ok {
+		minLength, maxLength = rule.minLength, rule.maxLength
+	}
+
+	if len(p.National) < minLength {
+		return PhoneNumber{}, fmt.Errorf("number is too short")
+	}
+	if len(p.National) > maxLength {
+		return PhoneNumber{}, fmt.Errorf("number is too long")
+	}
+	return p, nil
+}
+
+// InvalidRecipient is a recipient that could not be parsed
+type InvalidRecipient struct {
+	Recipient string
+	Err       error
+}
+
+// InvalidRecipientsError lists the recipients of a destination that are not
+// valid phone numbers. It matches ErrInvalidDestination with errors.Is.
+type InvalidRecipientsError struct {
+	Recipients []*InvalidRecipient
+}
+
+func (e *InvalidRecipientsError) Error() string {
+	parts := []string{}
+	for _, r := range e.Recipients {
+		parts = append(parts, fmt.Sprintf("%s (%s)", r.Recipient, r.Err))
+	}
+	return "invalid recipients: " + strings.Join(parts, ", ")
+}
+
+// Unwrap returns ErrInvalidDestination
+func (e *InvalidRecipientsError) Unwrap() error {
+	return ErrInvalidDestination
+}
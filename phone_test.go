@@ -0,0 +1,105 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PhoneSuite{})
+
+type PhoneSuite struct{}
+
+// -------------------------------------------------------------
+// Parsing
+
+func (suite *PhoneSuite) Test_ParsePhoneNumber_Valid(c *C) {
+	for number, cc := range map[string][2]string{
+		"+46703112233":        {"", "+46703112233"},
+		"0046703112233":       {"", "+46703112233"},
+		"+46 (0)70-311 22 33": {"", "+46703112233"},
+		"070-311 22 33":       {"46", "+46703112233"},
+		"08-123 456 78":       {"46", "+46812345678"},
+		"+47 412 34 567":      {"", "+4741234567"},
+		"412 34 567":          {"47", "+4741234567"},
+		"(555) 123-4567":      {"1", "+15551234567"},
+		"1-555-123-4567":      {"1", "+15551234567"},
+		"+1 555 123 4567":     {"", "+15551234567"},
+		"07700 900123":        {"44", "+447700900123"},
+		"+86 138 0013 8000":   {"", "+8613800138000"},
+		"0138 0013 8000":      {"86", "+8613800138000"},
+	} {
+		p, err := ParsePhoneNumber(number, cc[0])
+		c.Assert(err, IsNil, Commentf(number))
+		c.Assert(p.E164(), Equals, cc[1], Commentf(number))
+	}
+}
+
+func (suite *PhoneSuite) Test_ParsePhoneNumber_Split(c *C) {
+	p, err := ParsePhoneNumber("+358 40 123 4567", "")
+	c.Assert(err, IsNil)
+	c.Assert(p, DeepEquals, PhoneNumber{CountryCode: "358", National: "401234567"})
+	c.Assert(p.international(), Equals, "00358401234567")
+}
+
+func (suite *PhoneSuite) Test_ParsePhoneNumber_Invalid(c *C) {
+	for number, msg := range map[string]string{
+		"555-123-45":          "national number has no country code",
+		"070-CALL-ME":         "invalid character 'C'",
+		"46+703112233":        "invalid character '\\+'",
+		"--":                  "number has no digits",
+		"+46 70 311":          "number is too short",
+		"+46 70 311 22 33 44": "number is too long",
+		"+4741234567890":      "number is too long",
+		"+1234567890123456":   "number is too long",
+	} {
+		_, err := ParsePhoneNumber(number, "")
+		c.Assert(err, ErrorMatches, msg, Commentf(number))
+	}
+}
+
+// -------------------------------------------------------------
+// Destination
+
+func (suite *PhoneSuite) Test_Destination_Normalized(c *C) {
+	d := &Destination{
+		Recipients:         []string{"070-311 22 33", "+47 412 34 567"},
+		DefaultCountryCode: "46",
+	}
+
+	numbers, err := d.Normalized()
+	c.Assert(err, IsNil)
+	c.Assert(numbers, DeepEquals, []string{"+46703112233", "+4741234567"})
+	c.Assert(d.Destinations(), Equals, "0046703112233,004741234567")
+}
+
+func (suite *PhoneSuite) Test_Destination_Validate(c *C) {
+	d := &Destination{
+		Recipients: []string{"0046703112233", "555-123-45", "abc"},
+	}
+
+	err := d.Validate()
+	c.Assert(err, ErrorMatches, `invalid recipients: 555-123-45 \(national number has no country code\), abc \(invalid character 'a'\)`)
+	c.Assert(errors.Is(err, ErrInvalidDestination), Equals, true)
+
+	var invalid *InvalidRecipientsError
+	c.Assert(errors.As(err, &invalid), Equals, true)
+	c.Assert(invalid.Recipients, HasLen, 2)
+	c.Assert(invalid.Recipients[0].Recipient, Equals, "555-123-45")
+	c.Assert(invalid.Recipients[0].Err, Equals, ErrMissingCountryCode)
+}
@@ -0,0 +1,361 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrItemNotFound is returned when a queue has no item with an id
+var ErrItemNotFound = errors.New("outbox item not found")
+
+// Queue stores outbox items. Implementations must be safe for concurrent
+// use and must not keep references to the items passed in or returned.
+type Queue interface {
+	// Put adds an item or replaces the item with the same id
+	Put(item *OutboxItem) error
+	// Get returns the item with the id, or ErrItemNotFound
+	Get(id string) (*OutboxItem, error)
+	// Update calls fn with the item with the id and stores the changes made,
+	// unless fn returns an error. No other change is made to the item
+	// until fn returns.
+	Update(id string, fn func(*OutboxItem) error) error
+	// Claim marks the oldest pending item that is due at now as sending and
+	// returns it, or returns nil if there is none.
+	Claim(now time.Time) (*OutboxItem, error)
+}
+
+// MemoryQueue is a Queue that is lost when the process exits
+type MemoryQueue struct {
+	mu    sync.Mutex
+	items map[string]*OutboxItem
+	// pending holds the ids of unfinished items in the order they were added
+	pending []string
+}
+
+// NewMemoryQueue returns an empty MemoryQueue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{items: map[string]*OutboxItem{}}
+}
+
+// Put implements Queue
+func (q *MemoryQueue) Put(item *OutboxItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.put(item.copy())
+	return nil
+}
+
+func (q *MemoryQueue) put(item *OutboxItem) {
+	if _, ok := q.items[item.ID]; !ok && !item.Status.final() {
+		q.pending = append(q.pending, item.ID)
+	}
+	q.items[item.ID] = item
+}
+
+// Get implements Queue
+func (q *MemoryQueue) Get(id string) (*OutboxItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[id]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	return item.copy(), nil
+}
+
+// Update implements Queue
+func (q *MemoryQueue) Update(id string, fn func(*OutboxItem) error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, err := q.update(id, fn)
+	if err != nil {
+		return err
+	}
+	q.put(item)
+	return nil
+}
+
+// update returns a changed copy of the item with the id
+func (q *MemoryQueue) update(id string, fn func(*OutboxItem) error) (*OutboxItem, error) {
+	item, ok := q.items[id]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+
+	changed := item.copy()
+	if err := fn(changed); err != nil {
+		return nil, err
+	}
+	changed.ID = id
+	return changed, nil
+}
+
+// Claim implements Queue
+func (q *MemoryQueue) Claim(now time.Time) (*OutboxItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item := q.claim(now)
+	if item == nil {
+		return nil, nil
+	}
+	return item.copy(), nil
+}
+
+func (q *MemoryQueue) claim(now time.Time) *OutboxItem {
+	pending := q.pending[:0]
+	var claimed *OutboxItem
+	for _, id := range q.pending {
+		item := q.items[id]
+		if item.Status.final() {
+			continue
+		}
+		pending = append(pending, id)
+
+		if claimed == nil && item.Status == OutboxPending && !item.NextAttempt.After(now) {
+			item.Status = OutboxSending
+			item.UpdatedAt = now
+			claimed = item
+		}
+	}
+	q.pending = pending
+
+	return claimed
+}
+
+// FileQueue is a Queue persisted in an append-only journal file. Every
+// change is written as a new record, and the latest record of each item is
+// loaded when the file is opened.
+type FileQueue struct {
+	mem  *MemoryQueue
+	path string
+	file *os.File
+}
+
+// OpenFileQueue opens or creates a journal file. Items that were being
+// sent when the file was last used are set to pending again, so a message
+// may be sent twice if the process stopped while sending it.
+func OpenFileQueue(path string) (*FileQueue, error) {
+	q := &FileQueue{
+		mem:  NewMemoryQueue(),
+		path: path,
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	q.file = file
+
+	return q, nil
+}
+
+func (q *FileQueue) load() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	size, err := q.read(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// drop a record cut short by a crash while it was written, so new
+	// records are not appended to it
+	info, err := os.Stat(q.path)
+	if err != nil {
+		return err
+	}
+	if info.Size() > size {
+		return os.Truncate(q.path, size)
+	}
+	return nil
+}
+
+// read loads the records of a journal and returns the size of the complete
+// records. A last record without a newline was not fully written and is
+// left out.
+func (q *FileQueue) read(file *os.File) (int64, error) {
+	reader := bufio.NewReader(file)
+
+	var size int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+
+		item := &OutboxItem{}
+		if err := json.Unmarshal(data, item); err != nil {
+			return size, fmt.Errorf("%s:%d: %v", q.path, line, err)
+		}
+		if item.Status == OutboxSending {
+			item.Status = OutboxPending
+		}
+		q.mem.put(item)
+		size += int64(len(data))
+	}
+}
+
+// write appends a record of the item to the journal
+func (q *FileQueue) write(item *OutboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return q.file.Sync()
+}
+
+// Put implements Queue
+func (q *FileQueue) Put(item *OutboxItem) error {
+	q.mem.mu.Lock()
+	defer q.mem.mu.Unlock()
+
+	if err := q.write(item); err != nil {
+		return err
+	}
+	q.mem.put(item.copy())
+	return nil
+}
+
+// Get implements Queue
+func (q *FileQueue) Get(id string) (*OutboxItem, error) {
+	return q.mem.Get(id)
+}
+
+// Update implements Queue
+func (q *FileQueue) Update(id string, fn func(*OutboxItem) error) error {
+	q.mem.mu.Lock()
+	defer q.mem.mu.Unlock()
+
+	item, err := q.mem.update(id, fn)
+	if err != nil {
+		return err
+	}
+	if err := q.write(item); err != nil {
+		return err
+	}
+	q.mem.put(item)
+	return nil
+}
+
+// Claim implements Queue
+func (q *FileQueue) Claim(now time.Time) (*OutboxItem, error) {
+	q.mem.mu.Lock()
+	defer q.mem.mu.Unlock()
+
+	item := q.mem.claim(now)
+	if item == nil {
+		return nil, nil
+	}
+	if err := q.write(item); err != nil {
+		item.Status = OutboxPending
+		return nil, err
+	}
+	return item.copy(), nil
+}
+
+// Compact rewrites the journal with a single record per item
+func (q *FileQueue) Compact() error {
+	q.mem.mu.Lock()
+	defer q.mem.mu.Unlock()
+
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// pending items are written first and in order, so they are claimed in
+	// the same order when the journal is loaded
+	items := []*OutboxItem{}
+	for _, id := range q.mem.pending {
+		if item := q.mem.items[id]; !item.Status.final() {
+			items = append(items, item)
+		}
+	}
+	for _, item := range q.mem.items {
+		if item.Status.final() {
+			items = append(items, item)
+		}
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	q.file.Close()
+	q.file = file
+	return nil
+}
+
+// Close closes the journal file
+func (q *FileQueue) Close() error {
+	q.mem.mu.Lock()
+	defer q.mem.mu.Unlock()
+	return q.file.Close()
+}
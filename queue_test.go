@@ -0,0 +1,231 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&QueueSuite{})
+
+type QueueSuite struct{}
+
+func newTestItem(id string, status OutboxStatus, next time.Time) *OutboxItem {
+	return &OutboxItem{
+		ID:          id,
+		MessageType: "text",
+		Message:     []byte(`{"Text":"test"}`),
+		Status:      status,
+		NextAttempt: next,
+	}
+}
+
+// -------------------------------------------------------------
+// Memory queue
+
+func (suite *QueueSuite) Test_MemoryQueue_Claim(c *C) {
+	now := time.Now()
+	q := NewMemoryQueue()
+	q.Put(newTestItem("a", OutboxSent, now))
+	q.Put(newTestItem("b", OutboxPending, now.Add(time.Minute)))
+	q.Put(newTestItem("c", OutboxPending, now))
+	q.Put(newTestItem("d", OutboxPending, now))
+
+	item, err := q.Claim(now)
+	c.Assert(err, IsNil)
+	c.Assert(item.ID, Equals, "c")
+	c.Assert(item.Status, Equals, OutboxSending)
+
+	item, _ = q.Claim(now)
+	c.Assert(item.ID, Equals, "d")
+
+	item, _ = q.Claim(now)
+	c.Assert(item, IsNil)
+
+	item, _ = q.Claim(now.Add(time.Minute))
+	c.Assert(item.ID, Equals, "b")
+}
+
+func (suite *QueueSuite) Test_MemoryQueue_Get(c *C) {
+	q := NewMemoryQueue()
+	item := newTestItem("a", OutboxPending, time.Now())
+	q.Put(item)
+
+	// the queue keeps its own copy
+	item.Status = OutboxFailed
+
+	stored, err := q.Get("a")
+	c.Assert(err, IsNil)
+	c.Assert(stored.Status, Equals, OutboxPending)
+
+	_, err = q.Get("b")
+	c.Assert(err, Equals, ErrItemNotFound)
+}
+
+func (suite *QueueSuite) Test_MemoryQueue_Update(c *C) {
+	q := NewMemoryQueue()
+	q.Put(newTestItem("a", OutboxPending, time.Now()))
+
+	err := q.Update("a", func(item *OutboxItem) error {
+		item.Status = OutboxCanceled
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	item, _ := q.Get("a")
+	c.Assert(item.Status, Equals, OutboxCanceled)
+
+	err = q.Update("a", func(item *OutboxItem) error {
+		item.Status = OutboxPending
+		return fmt.Errorf("rejected")
+	})
+	c.Assert(err, ErrorMatches, "rejected")
+
+	item, _ = q.Get("a")
+	c.Assert(item.Status, Equals, OutboxCanceled)
+}
+
+// -------------------------------------------------------------
+// File queue
+
+func (suite *QueueSuite) Test_FileQueue_Reopen(c *C) {
+	path := filepath.Join(c.MkDir(), "outbox.journal")
+	now := time.Now()
+
+	q, err := OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	q.Put(newTestItem("a", OutboxPending, now))
+	q.Put(newTestItem("b", OutboxPending, now))
+
+	item, _ := q.Claim(now)
+	item.Status = OutboxSent
+	item.TrackingIDs = []string{"de8c4a032fb45ae65ab9e349a8dc2458"}
+	c.Assert(q.Put(item), IsNil)
+
+	// b is left as sending when the process stops
+	_, err = q.Claim(now)
+	c.Assert(err, IsNil)
+	c.Assert(q.Close(), IsNil)
+
+	q, err = OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	defer q.Close()
+
+	a, err := q.Get("a")
+	c.Assert(err, IsNil)
+	c.Assert(a.Status, Equals, OutboxSent)
+	c.Assert(a.TrackingIDs, DeepEquals, []string{"de8c4a032fb45ae65ab9e349a8dc2458"})
+
+	b, err := q.Claim(now)
+	c.Assert(err, IsNil)
+	c.Assert(b.ID, Equals, "b")
+}
+
+func (suite *QueueSuite) Test_FileQueue_Compact(c *C) {
+	path := filepath.Join(c.MkDir(), "outbox.journal")
+	now := time.Now()
+
+	q, err := OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	defer q.Close()
+
+	q.Put(newTestItem("a", OutboxPending, now))
+	q.Claim(now)
+	q.Put(newTestItem("a", OutboxSent, now))
+
+	data, _ := ioutil.ReadFile(path)
+	c.Assert(strings.Count(string(data), "\n"), Equals, 3)
+
+	c.Assert(q.Compact(), IsNil)
+	data, _ = ioutil.ReadFile(path)
+	c.Assert(strings.Count(string(data), "\n"), Equals, 1)
+
+	// writes go to the compacted file
+	q.Put(newTestItem("b", OutboxPending, now))
+	data, _ = ioutil.ReadFile(path)
+	c.Assert(strings.Count(string(data), "\n"), Equals, 2)
+}
+
+func (suite *QueueSuite) Test_FileQueue_CompactOrder(c *C) {
+	path := filepath.Join(c.MkDir(), "outbox.journal")
+	now := time.Now()
+
+	q, err := OpenFileQueue(path)
+	c.Assert(err, IsNil)
+
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, id := range ids {
+		q.Put(newTestItem(id, OutboxPending, now))
+	}
+	q.Put(newTestItem("sent", OutboxSent, now))
+	c.Assert(q.Compact(), IsNil)
+	c.Assert(q.Close(), IsNil)
+
+	q, err = OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	defer q.Close()
+
+	for _, id := range ids {
+		item, err := q.Claim(now)
+		c.Assert(err, IsNil)
+		c.Assert(item.ID, Equals, id)
+	}
+}
+
+func (suite *QueueSuite) Test_FileQueue_TornRecord(c *C) {
+	path := filepath.Join(c.MkDir(), "outbox.journal")
+	now := time.Now()
+
+	q, err := OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	q.Put(newTestItem("a", OutboxPending, now))
+	c.Assert(q.Close(), IsNil)
+
+	// the process stopped while writing a record
+	data, _ := ioutil.ReadFile(path)
+	c.Assert(ioutil.WriteFile(path, append(data, `{"ID":"b","Sta`...), 0600), IsNil)
+
+	q, err = OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	_, err = q.Get("a")
+	c.Assert(err, IsNil)
+	_, err = q.Get("b")
+	c.Assert(err, Equals, ErrItemNotFound)
+
+	// new records are not appended to the torn one
+	c.Assert(q.Put(newTestItem("c", OutboxPending, now)), IsNil)
+	c.Assert(q.Close(), IsNil)
+
+	q, err = OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	defer q.Close()
+	_, err = q.Get("c")
+	c.Assert(err, IsNil)
+}
+
+func (suite *QueueSuite) Test_FileQueue_Corrupt(c *C) {
+	path := filepath.Join(c.MkDir(), "outbox.journal")
+	c.Assert(ioutil.WriteFile(path, []byte("{not json\n"), 0600), IsNil)
+
+	_, err := OpenFileQueue(path)
+	c.Assert(err, ErrorMatches, ".*outbox.journal:1: .*")
+}
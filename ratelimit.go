@@ -0,0 +1,183 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned by a fail fast rate limiter without capacity
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrExceedsBurst is returned by a fail fast rate limiter for a message
+// needing more tokens than the burst, it can never be sent
+var ErrExceedsBurst = errors.New("message exceeds rate limit burst")
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens per second.
+// Tokens may be reserved ahead of time, leaving the bucket negative.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perSecond float64, burst int) *tokenBucket {
+	if perSecond <= 0 {
+		panic("cellsynt: rate limit must be positive")
+	}
+	return &tokenBucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// advance refills the bucket for the time passed since the last call
+func (b *tokenBucket) advance(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// giveBack returns reserved tokens that were not used
+func (b *tokenBucket) giveBack(n float64) {
+	b.tokens = math.Min(b.burst, b.tokens+n)
+}
+
+// wait returns the time until the bucket is no longer negative
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// RateLimiter limits the rate messages are sent at, for the whole account
+// and optionally for each originator. The zero value has no account limit.
+type RateLimiter struct {
+	// FailFast returns ErrRateLimited instead of waiting for capacity
+	FailFast bool
+	// CountSegments takes one token for every SMS part to every recipient
+	// instead of one for every request.
+	CountSegments bool
+
+	mu          sync.Mutex
+	account     *tokenBucket
+	originators map[string]*tokenBucket
+}
+
+// NewRateLimiter returns a limiter allowing perSecond messages per second
+// for the account, with bursts of up to burst messages. It panics if
+// perSecond is not positive.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		account:     newTokenBucket(perSecond, burst),
+		originators: map[string]*tokenBucket{},
+	}
+}
+
+// LimitOriginator adds a separate limit for messages from an originator.
+// The account limit still applies to these messages. It panics if perSecond
+// is not positive.
+func (l *RateLimiter) LimitOriginator(originator string, perSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.originators == nil {
+		l.originators = map[string]*tokenBucket{}
+	}
+	l.originators[originator] = newTokenBucket(perSecond, burst)
+}
+
+// Wait takes n tokens for a message from originator, waiting until they
+// are available or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context, originator string, n int) error {
+	l.mu.Lock()
+
+	buckets := []*tokenBucket{}
+	if l.account != nil {
+		buckets = append(buckets, l.account)
+	}
+	if b, ok := l.originators[originator]; ok {
+		buckets = append(buckets, b)
+	}
+
+	now := time.Now()
+	for _, b := range buckets {
+		b.advance(now)
+	}
+
+	if l.FailFast {
+		for _, b := range buckets {
+			if b.burst < float64(n) {
+				l.mu.Unlock()
+				return fmt.Errorf("%w: needs %d tokens, burst is %d", ErrExceedsBurst, n, int(b.burst))
+			}
+		}
+		for _, b := range buckets {
+			if b.tokens < float64(n) {
+				l.mu.Unlock()
+				return ErrRateLimited
+			}
+		}
+	}
+
+	var delay time.Duration
+	for _, b := range buckets {
+		b.tokens -= float64(n)
+		if d := b.wait(); d > delay {
+			delay = d
+		}
+	}
+	l.mu.Unlock()
+
+	if err := sleepContext(ctx, delay); err != nil {
+		// give back the reserved tokens
+		l.mu.Lock()
+		for _, b := range buckets {
+			b.giveBack(float64(n))
+		}
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// tokens returns the number of tokens needed to send a message
+func (l *RateLimiter) tokens(message Message, recipients int) int {
+	if !l.CountSegments {
+		return 1
+	}
+	return messageSegments(message) * recipients
+}
+
+// wait blocks until the rate limiter allows the message to be sent
+func (c *Client) wait(ctx context.Context, req *Request) error {
+	if c.RateLimiter == nil {
+		return nil
+	}
+
+	tokens := c.RateLimiter.tokens(req.Message, len(req.recipients()))
+	return c.RateLimiter.Wait(ctx, req.Params["originator"], tokens)
+}
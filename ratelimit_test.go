@@ -0,0 +1,216 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RateLimitSuite{})
+
+type RateLimitSuite struct{}
+
+// -------------------------------------------------------------
+// Token bucket
+
+func (suite *RateLimitSuite) Test_tokenBucket_advance(c *C) {
+	b := newTokenBucket(10, 5)
+	b.tokens = 0
+
+	b.advance(b.last.Add(200 * time.Millisecond))
+	c.Assert(b.tokens, Equals, 2.0)
+
+	b.advance(b.last.Add(time.Hour))
+	c.Assert(b.tokens, Equals, 5.0)
+
+	b.tokens = -1
+	c.Assert(b.wait(), Equals, 100*time.Millisecond)
+
+	// tokens given back never exceed the burst
+	b.tokens = 4
+	b.giveBack(2)
+	c.Assert(b.tokens, Equals, 5.0)
+}
+
+// -------------------------------------------------------------
+// Rate limiter
+
+func (suite *RateLimitSuite) Test_RateLimiter_Wait(c *C) {
+	l := NewRateLimiter(100, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		c.Assert(l.Wait(context.Background(), "", 1), IsNil)
+	}
+	c.Assert(time.Since(start) >= 20*time.Millisecond, Equals, true)
+}
+
+func (suite *RateLimitSuite) Test_RateLimiter_FailFast(c *C) {
+	l := NewRateLimiter(1, 2)
+	l.FailFast = true
+
+	c.Assert(l.Wait(context.Background(), "", 2), IsNil)
+	c.Assert(l.Wait(context.Background(), "", 1), Equals, ErrRateLimited)
+}
+
+func (suite *RateLimitSuite) Test_RateLimiter_FailFast_ExceedsBurst(c *C) {
+	l := NewRateLimiter(1, 5)
+	l.FailFast = true
+
+	err := l.Wait(context.Background(), "", 6)
+	c.Assert(errors.Is(err, ErrExceedsBurst), Equals, true)
+	c.Assert(err, ErrorMatches, "message exceeds rate limit burst: needs 6 tokens, burst is 5")
+
+	// no tokens are taken
+	c.Assert(l.Wait(context.Background(), "", 5), IsNil)
+
+	l.LimitOriginator("test", 1, 2)
+	c.Assert(errors.Is(l.Wait(context.Background(), "test", 3), ErrExceedsBurst), Equals, true)
+}
+
+func (suite *RateLimitSuite) Test_RateLimiter_Canceled(c *C) {
+	l := NewRateLimiter(1, 1)
+	c.Assert(l.Wait(context.Background(), "", 1), IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(l.Wait(ctx, "", 1), Equals, context.DeadlineExceeded)
+
+	// the canceled reservation is given back
+	c.Assert(l.account.tokens > -1, Equals, true)
+}
+
+func (suite *RateLimitSuite) Test_RateLimiter_Originator(c *C) {
+	l := NewRateLimiter(100, 10)
+	l.FailFast = true
+	l.LimitOriginator("campaign", 1, 1)
+
+	c.Assert(l.Wait(context.Background(), "campaign", 1), IsNil)
+	c.Assert(l.Wait(context.Background(), "campaign", 1), Equals, ErrRateLimited)
+	c.Assert(l.Wait(context.Background(), "alerts", 1), IsNil)
+}
+
+func (suite *RateLimitSuite) Test_RateLimiter_ZeroValue(c *C) {
+	l := &RateLimiter{FailFast: true}
+	c.Assert(l.Wait(context.Background(), "campaign", 1), IsNil)
+
+	l.LimitOriginator("campaign", 1, 1)
+	c.Assert(l.Wait(context.Background(), "campaign", 1), IsNil)
+	c.Assert(l.Wait(context.Background(), "campaign", 1), Equals, ErrRateLimited)
+	c.Assert(l.Wait(context.Background(), "alerts", 1), IsNil)
+}
+
+func (suite *RateLimitSuite) Test_NewRateLimiter_ZeroRate(c *C) {
+	c.Assert(func() { NewRateLimiter(0, 1) }, PanicMatches, "cellsynt: rate limit must be positive")
+}
+
+func (suite *RateLimitSuite) Test_RateLimiter_tokens(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703112244"},
+		},
+		Text: strings.Repeat("a", 200),
+	}
+
+	l := NewRateLimiter(1, 1)
+	c.Assert(l.tokens(r, 2), Equals, 1)
+
+	l.CountSegments = true
+	c.Assert(l.tokens(r, 2), Equals, 4)
+}
+
+// -------------------------------------------------------------
+// Client
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_RateLimited(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	suite.client.RateLimiter = NewRateLimiter(0.001, 1)
+	suite.client.RateLimiter.FailFast = true
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+
+	_, err = suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrRateLimited), Equals, true)
+
+	// no request was made
+	var sendErr *SendError
+	c.Assert(errors.As(err, &sendErr), Equals, true)
+	c.Assert(sendErr.Attempts, Equals, 0)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_RateLimitExceedsBurst(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703445566"},
+		},
+		Text: strings.Repeat("a", 400),
+	}
+
+	suite.client.RateLimiter = NewRateLimiter(100, 5)
+	suite.client.RateLimiter.FailFast = true
+	suite.client.RateLimiter.CountSegments = true
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrExceedsBurst), Equals, true)
+	c.Assert(IsRetryable(err), Equals, false)
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_RateLimitOriginator(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Options: &Options{
+			Originator: "campaign",
+		},
+		Text: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	suite.client.RateLimiter = NewRateLimiter(100, 10)
+	suite.client.RateLimiter.FailFast = true
+	suite.client.RateLimiter.LimitOriginator("campaign", 0.001, 1)
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+
+	_, err = suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrRateLimited), Equals, true)
+}
@@ -0,0 +1,181 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+)
+
+// RetryClass is a set of error classes that can be retried
+type RetryClass int
+
+const (
+	// RetryConnection are errors where the request never reached the
+	// gateway, like failed DNS lookups or refused connections.
+	RetryConnection RetryClass = 1 << iota
+	// RetryNetwork are all other transport errors. The gateway may already
+	// have accepted the message, so retrying can send it twice.
+	RetryNetwork
+	// RetryServer are 5xx responses that do not contain a gateway reply.
+	RetryServer
+	// RetryThrottled are messages stopped by a fail fast rate limiter
+	// before being sent. They are only retried if set in RetryOn. An open
+	// circuit breaker is never retried.
+	RetryThrottled
+)
+
+// Default values used for unset RetryPolicy fields
+const (
+	DefaultRetryClasses   = RetryConnection | RetryServer
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultBackoffFactor  = 2.0
+)
+
+// RetryPolicy controls how failed requests are retried. A message is never
+// retried once the gateway has responded with tracking ids.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of requests made, including the first.
+	MaxAttempts int
+
+	// Backoff between attempts grows by Multiplier from InitialBackoff
+	// up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter is the fraction (0-1) of the backoff that is randomized
+	Jitter float64
+
+	// RetryOn is the error classes to retry, DefaultRetryClasses if 0
+	RetryOn RetryClass
+}
+
+// responseReadError is returned when a response could not be read. The
+// gateway may have accepted the message, so these are never retried.
+type responseReadError struct {
+	err error
+}
+
+func (e *responseReadError) Error() string { return "reading response: " + e.err.Error() }
+func (e *responseReadError) Unwrap() error { return e.err }
+
+// retryClass returns the class of an error returned from a request, or 0 if
+// the error can not be retried.
+func retryClass(err error) RetryClass {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0
+	}
+
+	var partialErr *PartialSendError
+	if errors.As(err, &partialErr) || errors.Is(err, ErrCircuitOpen) {
+		return 0
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return RetryThrottled
+	}
+
+	var readErr *responseReadError
+	if errors.As(err, &readErr) {
+		return 0
+	}
+
+	var gwErr *Error
+	if errors.As(err, &gwErr) {
+		if gwErr.Code == ErrorCodeServer {
+			return RetryServer
+		}
+		return 0
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return RetryConnection
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return RetryConnection
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return RetryNetwork
+	}
+
+	return 0
+}
+
+// IsRetryable reports if err belongs to one of the default retry classes
+func IsRetryable(err error) bool {
+	return retryClass(err)&DefaultRetryClasses != 0
+}
+
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	classes := p.RetryOn
+	if classes == 0 {
+		classes = DefaultRetryClasses
+	}
+	return retryClass(err)&classes != 0
+}
+
+// backoff returns the time to wait after the given attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = DefaultBackoffFactor
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	delay -= delay * jitter * rand.Float64()
+
+	return time.Duration(delay)
+}
+
+// sleepContext waits for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
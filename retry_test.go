@@ -0,0 +1,99 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RetrySuite{})
+
+type RetrySuite struct{}
+
+// -------------------------------------------------------------
+// Classification
+
+func (suite *RetrySuite) Test_retryClass(c *C) {
+	dial := &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	read := &url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: errors.New("connection reset")}}
+
+	c.Assert(retryClass(dial), Equals, RetryConnection)
+	c.Assert(retryClass(read), Equals, RetryNetwork)
+	c.Assert(retryClass(&Error{Code: ErrorCodeServer}), Equals, RetryServer)
+	c.Assert(retryClass(ErrRateLimited), Equals, RetryThrottled)
+	c.Assert(retryClass(&CircuitOpenError{}), Equals, RetryClass(0))
+	c.Assert(retryClass(&Error{Code: ErrorCodeAuthentication}), Equals, RetryClass(0))
+	c.Assert(retryClass(&responseReadError{io.ErrUnexpectedEOF}), Equals, RetryClass(0))
+	c.Assert(retryClass(&url.Error{Op: "Post", Err: context.Canceled}), Equals, RetryClass(0))
+}
+
+func (suite *RetrySuite) Test_RetryPolicy_shouldRetry(c *C) {
+	var nilPolicy *RetryPolicy
+	c.Assert(nilPolicy.shouldRetry(1, &Error{Code: ErrorCodeServer}), Equals, false)
+
+	p := &RetryPolicy{MaxAttempts: 3}
+	c.Assert(p.shouldRetry(1, &Error{Code: ErrorCodeServer}), Equals, true)
+	c.Assert(p.shouldRetry(3, &Error{Code: ErrorCodeServer}), Equals, false)
+	c.Assert(p.shouldRetry(1, &url.Error{Op: "Post", Err: io.EOF}), Equals, false)
+
+	c.Assert(p.shouldRetry(1, ErrRateLimited), Equals, false)
+
+	p.RetryOn = RetryThrottled
+	c.Assert(p.shouldRetry(1, ErrRateLimited), Equals, true)
+
+	p.RetryOn = RetryNetwork
+	c.Assert(p.shouldRetry(1, &url.Error{Op: "Post", Err: io.EOF}), Equals, true)
+	c.Assert(p.shouldRetry(1, &Error{Code: ErrorCodeServer}), Equals, false)
+}
+
+// -------------------------------------------------------------
+// Backoff
+
+func (suite *RetrySuite) Test_RetryPolicy_backoff(c *C) {
+	p := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     3,
+	}
+	c.Assert(p.backoff(1), Equals, 100*time.Millisecond)
+	c.Assert(p.backoff(2), Equals, 300*time.Millisecond)
+	c.Assert(p.backoff(3), Equals, 900*time.Millisecond)
+	c.Assert(p.backoff(4), Equals, time.Second)
+}
+
+func (suite *RetrySuite) Test_RetryPolicy_backoff_Defaults(c *C) {
+	p := &RetryPolicy{}
+	c.Assert(p.backoff(1), Equals, DefaultInitialBackoff)
+	c.Assert(p.backoff(20), Equals, DefaultMaxBackoff)
+}
+
+func (suite *RetrySuite) Test_RetryPolicy_backoff_Jitter(c *C) {
+	p := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		Jitter:         0.5,
+	}
+	for i := 0; i < 100; i++ {
+		d := p.backoff(1)
+		c.Assert(d >= 50*time.Millisecond && d <= 100*time.Millisecond, Equals, true)
+	}
+}
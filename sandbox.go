@@ -0,0 +1,94 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sandbox replaces the gateway of a client. Messages go through validation,
+// middleware, rate limiting and parameter building as usual, but instead of
+// being sent they are recorded, and synthetic tracking ids are returned.
+type Sandbox struct {
+	mu       sync.Mutex
+	messages []SandboxMessage
+}
+
+// SandboxMessage is a message recorded by a Sandbox
+type SandboxMessage struct {
+	Message Message
+	// Params are the parameters that would have been posted, without the password
+	Params map[string]string
+	Header http.Header
+	// Segments is the number of parts the message would be sent as
+	Segments    int
+	TrackingIDs []string
+	Time        time.Time
+}
+
+// NewSandbox returns an empty sandbox
+func NewSandbox() *Sandbox {
+	return &Sandbox{}
+}
+
+// Messages returns the recorded messages in the order they were sent
+func (s *Sandbox) Messages() []SandboxMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SandboxMessage(nil), s.messages...)
+}
+
+// Reset removes all recorded messages
+func (s *Sandbox) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+// record stores a request and returns a response with one tracking id for
+// every recipient, like the gateway does
+func (s *Sandbox) record(req *Request) *Response {
+	params := map[string]string{}
+	for k, v := range req.Params {
+		if k != "password" {
+			params[k] = v
+		}
+	}
+
+	ids := []string{}
+	for range strings.Split(params["destination"], ",") {
+		ids = append(ids, randomID())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, SandboxMessage{
+		Message:     req.Message,
+		Params:      params,
+		Header:      req.Header.Clone(),
+		Segments:    messageSegments(req.Message),
+		TrackingIDs: ids,
+		Time:        time.Now(),
+	})
+
+	return &Response{
+		Success:     true,
+		TrackingIDs: ids,
+	}
+}
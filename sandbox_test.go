@@ -0,0 +1,85 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+// -------------------------------------------------------------
+// Sandbox
+
+func (suite *CellsyntSuite) Test_Client_Sandbox(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233", "0046703445566"},
+		},
+		Text: strings.Repeat("a", 200),
+	}
+
+	suite.client.Sandbox = NewSandbox()
+	suite.client.Middleware = []Middleware{
+		func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				req.Header.Set("X-Request-Id", "abc123")
+				return next(ctx, req)
+			}
+		},
+	}
+
+	// no request is made to the mock server
+	response, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+	c.Assert(response.Success, Equals, true)
+	c.Assert(response.Attempts, Equals, 1)
+	c.Assert(response.TrackingIDs, HasLen, 2)
+	c.Assert(response.TrackingIDs[0], Matches, "[0-9a-f]{32}")
+
+	messages := suite.client.Sandbox.Messages()
+	c.Assert(messages, HasLen, 1)
+	c.Assert(messages[0].Message, Equals, Message(r))
+	c.Assert(messages[0].Segments, Equals, 2)
+	c.Assert(messages[0].TrackingIDs, DeepEquals, response.TrackingIDs)
+	c.Assert(messages[0].Header.Get("X-Request-Id"), Equals, "abc123")
+	c.Assert(messages[0].Params["destination"], Equals, "0046703112233,0046703445566")
+	c.Assert(messages[0].Params["allowconcat"], Equals, "2")
+	c.Assert(messages[0].Params["username"], Equals, "username")
+
+	_, ok := messages[0].Params["password"]
+	c.Assert(ok, Equals, false)
+
+	suite.client.Sandbox.Reset()
+	c.Assert(suite.client.Sandbox.Messages(), HasLen, 0)
+}
+
+func (suite *CellsyntSuite) Test_Client_Sandbox_Validation(c *C) {
+	r := &TextMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		Text: strings.Repeat("a", 2000),
+	}
+
+	suite.client.Sandbox = NewSandbox()
+
+	_, err := suite.client.SendMessage(r)
+	c.Assert(errors.Is(err, ErrMessageTooLong), Equals, true)
+	c.Assert(suite.client.Sandbox.Messages(), HasLen, 0)
+}
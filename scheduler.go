@@ -0,0 +1,64 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScheduleAt stores a message to be sent at a time and returns its local
+// id. To send at a local time for the recipient, create the time in their
+// location, e.g. time.Date(2016, 10, 1, 9, 0, 0, 0, stockholm).
+func (o *Outbox) ScheduleAt(message Message, at time.Time) (string, error) {
+	return o.add(message, at)
+}
+
+// ScheduleAfter stores a message to be sent after a delay and returns its
+// local id
+func (o *Outbox) ScheduleAfter(message Message, delay time.Duration) (string, error) {
+	return o.add(message, time.Now().Add(delay))
+}
+
+// Cancel stops a pending message from being sent
+func (o *Outbox) Cancel(id string) error {
+	return o.Queue.Update(id, func(item *OutboxItem) error {
+		if item.Status != OutboxPending {
+			return fmt.Errorf("can not cancel %s message", item.Status)
+		}
+		item.Status = OutboxCanceled
+		item.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// Reschedule changes when a pending message is sent
+func (o *Outbox) Reschedule(id string, at time.Time) error {
+	err := o.Queue.Update(id, func(item *OutboxItem) error {
+		if item.Status != OutboxPending {
+			return fmt.Errorf("can not reschedule %s message", item.Status)
+		}
+		item.NextAttempt = at
+		item.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	o.notify()
+	return nil
+}
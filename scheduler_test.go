@@ -0,0 +1,129 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"path/filepath"
+	"time"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+// -------------------------------------------------------------
+// Scheduling
+
+func (suite *CellsyntSuite) Test_Outbox_ScheduleAfter(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.PollInterval = 5 * time.Millisecond
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	start := time.Now()
+	id, err := outbox.ScheduleAfter(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	}, 50*time.Millisecond)
+	c.Assert(err, IsNil)
+
+	item, err := outbox.Status(id)
+	c.Assert(err, IsNil)
+	c.Assert(item.Status, Equals, OutboxPending)
+
+	item = waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxSent)
+	c.Assert(time.Since(start) >= 50*time.Millisecond, Equals, true)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Cancel(c *C) {
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	outbox.PollInterval = 5 * time.Millisecond
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.ScheduleAfter(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	}, 20*time.Millisecond)
+	c.Assert(err, IsNil)
+
+	c.Assert(outbox.Cancel(id), IsNil)
+	time.Sleep(40 * time.Millisecond)
+
+	item, err := outbox.Status(id)
+	c.Assert(err, IsNil)
+	c.Assert(item.Status, Equals, OutboxCanceled)
+
+	c.Assert(outbox.Cancel(id), ErrorMatches, "can not cancel canceled message")
+	c.Assert(outbox.Reschedule(id, time.Now()), ErrorMatches, "can not reschedule canceled message")
+	c.Assert(outbox.Cancel("unknown"), Equals, ErrItemNotFound)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_Reschedule(c *C) {
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+	})
+
+	outbox := NewOutbox(suite.client, NewMemoryQueue())
+	stop := runOutbox(c, outbox)
+	defer stop()
+
+	id, err := outbox.ScheduleAt(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	}, time.Now().Add(time.Hour))
+	c.Assert(err, IsNil)
+
+	c.Assert(outbox.Reschedule(id, time.Now()), IsNil)
+
+	item := waitStatus(c, outbox, id)
+	c.Assert(item.Status, Equals, OutboxSent)
+}
+
+func (suite *CellsyntSuite) Test_Outbox_ScheduleAt_Persisted(c *C) {
+	path := filepath.Join(c.MkDir(), "outbox.journal")
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		c.Skip("no time zone data")
+	}
+	at := time.Date(2030, 1, 2, 9, 0, 0, 0, stockholm)
+
+	queue, err := OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	id, err := NewOutbox(suite.client, queue).ScheduleAt(&TextMessage{
+		Destination: &Destination{Recipients: []string{"0046703112233"}},
+		Text:        "test",
+	}, at)
+	c.Assert(err, IsNil)
+	c.Assert(queue.Close(), IsNil)
+
+	queue, err = OpenFileQueue(path)
+	c.Assert(err, IsNil)
+	defer queue.Close()
+
+	item, err := NewOutbox(suite.client, queue).Status(id)
+	c.Assert(err, IsNil)
+	c.Assert(item.Status, Equals, OutboxPending)
+	c.Assert(item.NextAttempt.Equal(at), Equals, true)
+}
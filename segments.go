@@ -0,0 +1,316 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// Encoding is the character encoding a message is sent with
+type Encoding string
+
+const (
+	EncodingGSM7   Encoding = "gsm7"
+	EncodingUCS2   Encoding = "ucs2"
+	EncodingBinary Encoding = "binary"
+)
+
+// Segment sizes, a concatenated message reserves room for the
+// concatenation header in every part
+const (
+	gsmSingleLength    = 160
+	gsmPartLength      = 153
+	ucs2SingleLength   = 70
+	ucs2PartLength     = 67
+	binarySingleLength = 140
+
+	// concatIELength is the length of an 8-bit concatenation information element
+	concatIELength = 5
+
+	// MaxConcatParts is the maximum number of parts in a concatenated message
+	MaxConcatParts = 6
+
+	// maxBinaryParts is the number of parts an 8-bit concatenation
+	// information element can number
+	maxBinaryParts = 255
+)
+
+// ErrMessageTooLong is returned when a message needs more parts than allowed
+var ErrMessageTooLong = errors.New("message too long")
+
+// SegmentInfo describes how a message is split into SMS parts
+type SegmentInfo struct {
+	Encoding Encoding
+	// Length is the number of septets, UTF-16 code units or octets
+	Length int
+	// Segments is the number of SMS parts used
+	Segments int
+	// Remaining is the number of characters that fit in the last segment
+	Remaining int
+	// ConcatSufficient is set if AllowConcat of the message allows all
+	// segments. An AllowConcat of 0 allows MaxConcatParts, use
+	// Client.Segments to check against the client default instead.
+	ConcatSufficient bool
+}
+
+// Segmenter is implemented by messages that can count their segments
+type Segmenter interface {
+	Segments() SegmentInfo
+}
+
+// countSegments splits a sequence of characters, each taking cost units,
+// into segments. A character is never split between segments.
+func countSegments(costs []int, single, part int) (length, segments, remaining int) {
+	for _, cost := range costs {
+		length += cost
+	}
+	if length <= single {
+		return length, 1, single - length
+	}
+
+	segments, used := 1, 0
+	for _, cost := range costs {
+		if used+cost > part {
+			segments++
+			used = 0
+		}
+		used += cost
+	}
+	return length, segments, part - used
+}
+
+// gsmCosts returns the number of septets used by each character. Characters
+// outside the alphabet are replaced by the gateway and count as one.
+func gsmCosts(text string) []int {
+	costs := []int{}
+	for _, r := range text {
+		if _, ok := gsmExtensionIndex[r]; ok {
+			costs = append(costs, 2)
+		} else {
+			costs = append(costs, 1)
+		}
+	}
+	return costs
+}
+
+// ucs2Costs returns the number of UTF-16 code units used by each character
+func ucs2Costs(text string) []int {
+	costs := []int{}
+	for _, r := range text {
+		if r > 0xFFFF {
+			costs = append(costs, 2)
+		} else {
+			costs = append(costs, 1)
+		}
+	}
+	return costs
+}
+
+func textSegments(encoding Encoding, text string, allowConcat int) SegmentInfo {
+	info := SegmentInfo{Encoding: encoding}
+	if encoding == EncodingUCS2 {
+		info.Length, info.Segments, info.Remaining = countSegments(ucs2Costs(text), ucs2SingleLength, ucs2PartLength)
+	} else {
+		info.Length, info.Segments, info.Remaining = countSegments(gsmCosts(text), gsmSingleLength, gsmPartLength)
+	}
+
+	if allowConcat == 0 {
+		allowConcat = MaxConcatParts
+	}
+	info.ConcatSufficient = info.Segments <= allowConcat || info.Segments == 1
+
+	return info
+}
+
+// Segments implements Segmenter
+func (m *TextMessage) Segments() SegmentInfo {
+	return textSegments(EncodingGSM7, m.Text, m.AllowConcat)
+}
+
+// Segments implements Segmenter
+func (m *FlashMessage) Segments() SegmentInfo {
+	return textSegments(EncodingGSM7, m.Text, m.AllowConcat)
+}
+
+// Segments implements Segmenter
+func (m *UnicodeMessage) Segments() SegmentInfo {
+	return textSegments(EncodingUCS2, m.Text, m.AllowConcat)
+}
+
+// Segments implements Segmenter. Data that does not fit in a single
+// message is counted as split with a concatenation header in every part.
+func (m *BinaryMessage) Segments() SegmentInfo {
+	costs := make([]int, len(m.Binary))
+	for i := range costs {
+		costs[i] = 1
+	}
+
+	// the header length octet is only needed when there is no other header
+	partLength := binarySingleLength - len(m.UDH) - concatIELength
+	if len(m.UDH) == 0 {
+		partLength--
+	}
+
+	info := SegmentInfo{Encoding: EncodingBinary}
+	info.Length, info.Segments, info.Remaining = countSegments(costs, binarySingleLength-len(m.UDH), partLength)
+	info.ConcatSufficient = info.Segments <= maxBinaryParts
+
+	return info
+}
+
+// concatRef is the reference number of the last concatenated binary message
+var concatRef uint32
+
+// validate checks that the header is well formed and that the message
+// fits in a single SMS
+func (m *BinaryMessage) validate() error {
+	if _, err := ParseUDH(m.UDH); err != nil {
+		return err
+	}
+	if n := len(m.UDH) + len(m.Binary); n > binarySingleLength {
+		return fmt.Errorf("%w: binary needs %d octets, at most %d allowed", ErrMessageTooLong, n, binarySingleLength)
+	}
+	return nil
+}
+
+// Split returns the message as concatenated parts that each fit in a single
+// SMS. A Concat8 information element is added to the header of every part.
+// A message that already fits is returned as it is.
+func (m *BinaryMessage) Split() ([]*BinaryMessage, error) {
+	udh, err := ParseUDH(m.UDH)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.UDH)+len(m.Binary) <= binarySingleLength {
+		return []*BinaryMessage{m}, nil
+	}
+
+	// the existing information elements are kept in every part
+	partLength := binarySingleLength - len(append(udh, Concat8{}).Bytes())
+	if partLength <= 0 {
+		return nil, fmt.Errorf("%w: udh leaves no room for data", ErrMessageTooLong)
+	}
+
+	info := m.Segments()
+	if info.Segments > maxBinaryParts {
+		return nil, fmt.Errorf("%w: binary needs %d parts, at most %d allowed", ErrMessageTooLong, info.Segments, maxBinaryParts)
+	}
+
+	ref := byte(atomic.AddUint32(&concatRef, 1))
+	parts := make([]*BinaryMessage, 0, info.Segments)
+	for i := 0; i < info.Segments; i++ {
+		start := i * partLength
+		end := start + partLength
+		if end > len(m.Binary) {
+			end = len(m.Binary)
+		}
+
+		concat := Concat8{Reference: ref, Total: byte(info.Segments), Sequence: byte(i + 1)}
+
+		part := *m
+		part.UDH = append(udh[:len(udh):len(udh)], concat).Bytes()
+		part.Binary = m.Binary[start:end]
+		parts = append(parts, &part)
+	}
+	return parts, nil
+}
+
+// multipartMessage is implemented by messages that are sent as several
+// separate requests when they are too large for a single SMS
+type multipartMessage interface {
+	parts() ([]Message, error)
+}
+
+// binaryEncoded is implemented by messages that are sent as binary data
+type binaryEncoded interface {
+	binaryMessage() (*BinaryMessage, error)
+}
+
+func (m *BinaryMessage) binaryMessage() (*BinaryMessage, error) { return m, nil }
+
+func (m *BinaryMessage) parts() ([]Message, error) {
+	split, err := m.Split()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]Message, len(split))
+	for i, part := range split {
+		parts[i] = part
+	}
+	return parts, nil
+}
+
+// Segments returns how a message is split into SMS parts when sent by the
+// client, a message without AllowConcat uses the AllowConcat of the client.
+func (c *Client) Segments(message Message) SegmentInfo {
+	s, ok := message.(Segmenter)
+	if !ok {
+		return SegmentInfo{Segments: 1, ConcatSufficient: true}
+	}
+
+	info := s.Segments()
+	if info.Encoding == EncodingBinary {
+		return info
+	}
+
+	allowConcat := c.AllowConcat
+	if v, ok := message.GetParameters()["allowconcat"]; ok {
+		allowConcat, _ = strconv.Atoi(v)
+	}
+	info.ConcatSufficient = info.Segments <= allowConcat || info.Segments == 1
+	return info
+}
+
+// resolveConcat replaces the maximum number of parts in the allowconcat
+// parameter with the number of parts the message needs, or returns an error
+// if the message does not fit.
+func resolveConcat(message Message, params map[string]string) error {
+	maxParts := 1
+	if v, ok := params["allowconcat"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxConcatParts {
+			return fmt.Errorf("allowconcat must be between 1 and %d, got %s", MaxConcatParts, v)
+		}
+		maxParts = n
+	}
+
+	s, ok := message.(Segmenter)
+	if !ok {
+		return nil
+	}
+
+	info := s.Segments()
+	delete(params, "allowconcat")
+	if b, ok := message.(binaryEncoded); ok {
+		m, err := b.binaryMessage()
+		if err != nil {
+			return err
+		}
+		return m.validate()
+	}
+
+	if info.Segments > maxParts {
+		return fmt.Errorf("%w: %s needs %d parts, at most %d allowed", ErrMessageTooLong, message.Type(), info.Segments, maxParts)
+	}
+	if info.Segments > 1 {
+		params["allowconcat"] = strconv.Itoa(info.Segments)
+	}
+	return nil
+}
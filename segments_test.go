@@ -0,0 +1,238 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&SegmentsSuite{})
+
+type SegmentsSuite struct{}
+
+// -------------------------------------------------------------
+// Text
+
+func (suite *SegmentsSuite) Test_TextMessage_Segments_Single(c *C) {
+	r := &TextMessage{Text: strings.Repeat("a", 160)}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingGSM7,
+		Length:           160,
+		Segments:         1,
+		Remaining:        0,
+		ConcatSufficient: true,
+	})
+}
+
+func (suite *SegmentsSuite) Test_TextMessage_Segments_Concat(c *C) {
+	r := &TextMessage{Text: strings.Repeat("a", 161), AllowConcat: 1}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingGSM7,
+		Length:           161,
+		Segments:         2,
+		Remaining:        145,
+		ConcatSufficient: false,
+	})
+
+	r.AllowConcat = 2
+	c.Assert(r.Segments().ConcatSufficient, Equals, true)
+
+	// AllowConcat is inherited from the client when not set
+	r.AllowConcat = 0
+	c.Assert(r.Segments().ConcatSufficient, Equals, true)
+	r.Text = strings.Repeat("a", 7*153)
+	c.Assert(r.Segments().ConcatSufficient, Equals, false)
+}
+
+func (suite *SegmentsSuite) Test_Client_Segments(c *C) {
+	r := &TextMessage{Text: strings.Repeat("a", 200)}
+
+	client := NewClient("username", "password", "sendername")
+	c.Assert(client.Segments(r).Segments, Equals, 2)
+	c.Assert(client.Segments(r).ConcatSufficient, Equals, true)
+
+	client.AllowConcat = 0
+	c.Assert(client.Segments(r).ConcatSufficient, Equals, false)
+
+	// the message has priority over the client
+	r.AllowConcat = 2
+	c.Assert(client.Segments(r).ConcatSufficient, Equals, true)
+
+	b := &BinaryMessage{Binary: make([]byte, 300)}
+	c.Assert(client.Segments(b), DeepEquals, b.Segments())
+}
+
+func (suite *SegmentsSuite) Test_TextMessage_Segments_Extension(c *C) {
+	r := &TextMessage{Text: strings.Repeat("€", 80)}
+	c.Assert(r.Segments().Length, Equals, 160)
+	c.Assert(r.Segments().Segments, Equals, 1)
+
+	// an escaped character is never split between two parts
+	r = &TextMessage{Text: strings.Repeat("a", 152) + "€" + strings.Repeat("a", 10)}
+	info := r.Segments()
+	c.Assert(info.Length, Equals, 164)
+	c.Assert(info.Segments, Equals, 2)
+	c.Assert(info.Remaining, Equals, 141)
+}
+
+func (suite *SegmentsSuite) Test_TextMessage_Segments_TooLong(c *C) {
+	r := &TextMessage{Text: strings.Repeat("a", 7*153), AllowConcat: 6}
+	c.Assert(r.Segments().Segments, Equals, 7)
+	c.Assert(r.Segments().ConcatSufficient, Equals, false)
+}
+
+func (suite *SegmentsSuite) Test_FlashMessage_Segments(c *C) {
+	r := &FlashMessage{Text: "test"}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingGSM7,
+		Length:           4,
+		Segments:         1,
+		Remaining:        156,
+		ConcatSufficient: true,
+	})
+}
+
+// -------------------------------------------------------------
+// Unicode
+
+func (suite *SegmentsSuite) Test_UnicodeMessage_Segments(c *C) {
+	r := &UnicodeMessage{Text: strings.Repeat("Ω", 70)}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingUCS2,
+		Length:           70,
+		Segments:         1,
+		Remaining:        0,
+		ConcatSufficient: true,
+	})
+
+	r = &UnicodeMessage{Text: strings.Repeat("Ω", 71), AllowConcat: 6}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingUCS2,
+		Length:           71,
+		Segments:         2,
+		Remaining:        63,
+		ConcatSufficient: true,
+	})
+}
+
+func (suite *SegmentsSuite) Test_UnicodeMessage_Segments_SurrogatePairs(c *C) {
+	r := &UnicodeMessage{Text: strings.Repeat("😀", 35)}
+	c.Assert(r.Segments().Length, Equals, 70)
+	c.Assert(r.Segments().Segments, Equals, 1)
+}
+
+// -------------------------------------------------------------
+// Binary
+
+func (suite *SegmentsSuite) Test_BinaryMessage_Segments(c *C) {
+	r := &BinaryMessage{
+		UDH:    []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0},
+		Binary: make([]byte, 100),
+	}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingBinary,
+		Length:           100,
+		Segments:         1,
+		Remaining:        33,
+		ConcatSufficient: true,
+	})
+}
+
+func (suite *SegmentsSuite) Test_BinaryMessage_Segments_Oversize(c *C) {
+	r := &BinaryMessage{Binary: make([]byte, 300)}
+	c.Assert(r.Segments(), DeepEquals, SegmentInfo{
+		Encoding:         EncodingBinary,
+		Length:           300,
+		Segments:         3,
+		Remaining:        102,
+		ConcatSufficient: true,
+	})
+}
+
+func (suite *SegmentsSuite) Test_BinaryMessage_validate(c *C) {
+	r := &BinaryMessage{
+		UDH:    []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0},
+		Binary: make([]byte, 133),
+	}
+	c.Assert(r.validate(), IsNil)
+
+	r.Binary = make([]byte, 134)
+	c.Assert(errors.Is(r.validate(), ErrMessageTooLong), Equals, true)
+
+	r = &BinaryMessage{UDH: []byte{0x05, 0x00, 0x03}}
+	c.Assert(errors.Is(r.validate(), ErrInvalidParameter), Equals, true)
+}
+
+func (suite *SegmentsSuite) Test_BinaryMessage_Split_Single(c *C) {
+	r := &BinaryMessage{Binary: make([]byte, 140)}
+
+	parts, err := r.Split()
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Assert(parts[0], Equals, r)
+}
+
+func (suite *SegmentsSuite) Test_BinaryMessage_Split(c *C) {
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	r := &BinaryMessage{Binary: data}
+
+	parts, err := r.Split()
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, r.Segments().Segments)
+
+	ref := parts[0].UDH[3]
+	joined := []byte{}
+	for i, part := range parts {
+		c.Assert(part.UDH, DeepEquals, []byte{0x05, 0x00, 0x03, ref, 0x03, byte(i + 1)})
+		c.Assert(len(part.UDH)+len(part.Binary) <= 140, Equals, true)
+		joined = append(joined, part.Binary...)
+	}
+	c.Assert(joined, DeepEquals, data)
+	c.Assert(parts[2].Binary, HasLen, 300-2*134)
+}
+
+func (suite *SegmentsSuite) Test_BinaryMessage_Split_KeepsHeader(c *C) {
+	r := &BinaryMessage{
+		UDH:    []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0},
+		Binary: make([]byte, 200),
+	}
+
+	parts, err := r.Split()
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 2)
+
+	ref := parts[0].UDH[9]
+	c.Assert(parts[0].UDH, DeepEquals, []byte{0x0B, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0, 0x00, 0x03, ref, 0x02, 0x01})
+	c.Assert(parts[0].Binary, HasLen, 128)
+	c.Assert(parts[1].UDH, DeepEquals, []byte{0x0B, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0, 0x00, 0x03, ref, 0x02, 0x02})
+	c.Assert(parts[1].Binary, HasLen, 72)
+
+	// the original message is not modified
+	c.Assert(r.UDH, DeepEquals, []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0})
+}
+
+func (suite *SegmentsSuite) Test_BinaryMessage_Split_TooLong(c *C) {
+	r := &BinaryMessage{Binary: make([]byte, 134*255+1)}
+
+	_, err := r.Split()
+	c.Assert(errors.Is(err, ErrMessageTooLong), Equals, true)
+}
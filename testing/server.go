@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 
 	"github.com/kr/pretty"
 	. "gopkg.in/check.v1"
@@ -40,6 +41,8 @@ type MockServer struct {
 	BaseURL    string
 	Server     *httptest.Server
 	HTTPClient *http.Client
+
+	mu sync.Mutex
 }
 
 // MockResponse defines a response to a matching request. Requests are matched based on
@@ -93,12 +96,17 @@ func NewMockServer() *MockServer {
 
 // AddResponse adds a mock response that HandleRequest will look foor
 func (m *MockServer) AddResponse(r *MockResponse) *MockResponse {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.Responses = append(m.Responses, r)
 	return r
 }
 
 // VerifyNoMoreRequests checks that no requests are unmet
 func (m *MockServer) VerifyNoMoreRequests(c *C) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	unsatisified := []*MockResponse{}
 	for _, r := range m.Responses {
 		if !r.satisfied && !r.Persistant {
@@ -125,6 +133,8 @@ func (m *MockServer) Close() {
 // If a response with a matching url is found, the response body is written
 // to the writer and the CheckFn is called.
 func (m *MockServer) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	var response *MockResponse
 	for _, resp := range m.Responses {
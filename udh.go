@@ -0,0 +1,199 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Information element identifiers
+const (
+	IEIConcat8                  byte = 0x00
+	IEISpecialMessageIndication byte = 0x01
+	IEIPort8                    byte = 0x04
+	IEIPort16                   byte = 0x05
+	IEIConcat16                 byte = 0x08
+)
+
+// Well known application ports for Port16
+const (
+	PortWAPPush           uint16 = 2948
+	PortWAPConnectionless uint16 = 9200
+	PortVCard             uint16 = 9204
+	PortVCalendar         uint16 = 9205
+)
+
+// InformationElement is a single element of a user data header
+type InformationElement interface {
+	// Identifier returns the information element identifier
+	Identifier() byte
+	// Value returns the data of the element, without identifier and length
+	Value() []byte
+}
+
+// UDH is a user data header made of information elements
+type UDH []InformationElement
+
+// Bytes returns the header as expected by BinaryMessage.UDH, starting with
+// the header length octet. An empty header returns nil.
+func (u UDH) Bytes() []byte {
+	if len(u) == 0 {
+		return nil
+	}
+
+	b := []byte{0}
+	for _, ie := range u {
+		value := ie.Value()
+		b = append(b, ie.Identifier(), byte(len(value)))
+		b = append(b, value...)
+	}
+	b[0] = byte(len(b) - 1)
+	return b
+}
+
+// ParseUDH parses a header starting with the header length octet. Elements
+// of unknown types, or with unexpected lengths, are returned as RawElement.
+func ParseUDH(b []byte) (UDH, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if int(b[0]) != len(b)-1 {
+		return nil, fmt.Errorf("%w: udh length octet is %d, header has %d octets", ErrInvalidParameter, b[0], len(b)-1)
+	}
+
+	u := UDH{}
+	for rest := b[1:]; len(rest) > 0; {
+		if len(rest) < 2 || len(rest) < 2+int(rest[1]) {
+			return nil, fmt.Errorf("%w: udh information element 0x%02X is truncated", ErrInvalidParameter, rest[0])
+		}
+		id, value := rest[0], rest[2:2+int(rest[1])]
+		u = append(u, parseElement(id, value))
+		rest = rest[2+len(value):]
+	}
+	return u, nil
+}
+
+func parseElement(id byte, value []byte) InformationElement {
+	switch {
+	case id == IEIConcat8 && len(value) == 3:
+		return Concat8{Reference: value[0], Total: value[1], Sequence: value[2]}
+	case id == IEIConcat16 && len(value) == 4:
+		return Concat16{Reference: binary.BigEndian.Uint16(value), Total: value[2], Sequence: value[3]}
+	case id == IEIPort8 && len(value) == 2:
+		return Port8{Destination: value[0], Source: value[1]}
+	case id == IEIPort16 && len(value) == 4:
+		return Port16{Destination: binary.BigEndian.Uint16(value), Source: binary.BigEndian.Uint16(value[2:])}
+	case id == IEISpecialMessageIndication && len(value) == 2:
+		return SpecialMessageIndication{Store: value[0]&0x80 != 0, Type: IndicationType(value[0] & 0x7F), Count: value[1]}
+	}
+	return RawElement{ID: id, Data: append([]byte(nil), value...)}
+}
+
+// Concat8 is a concatenation element with an 8-bit reference number
+type Concat8 struct {
+	Reference byte
+	// Total is the number of parts, Sequence is this part starting at 1
+	Total, Sequence byte
+}
+
+// Identifier implements InformationElement
+func (e Concat8) Identifier() byte { return IEIConcat8 }
+
+// Value implements InformationElement
+func (e Concat8) Value() []byte { return []byte{e.Reference, e.Total, e.Sequence} }
+
+// Concat16 is a concatenation element with a 16-bit reference number
+type Concat16 struct {
+	Reference uint16
+	// Total is the number of parts, Sequence is this part starting at 1
+	Total, Sequence byte
+}
+
+// Identifier implements InformationElement
+func (e Concat16) Identifier() byte { return IEIConcat16 }
+
+// Value implements InformationElement
+func (e Concat16) Value() []byte {
+	return []byte{byte(e.Reference >> 8), byte(e.Reference), e.Total, e.Sequence}
+}
+
+// Port8 addresses an application with 8-bit port numbers
+type Port8 struct {
+	Destination, Source byte
+}
+
+// Identifier implements InformationElement
+func (e Port8) Identifier() byte { return IEIPort8 }
+
+// Value implements InformationElement
+func (e Port8) Value() []byte { return []byte{e.Destination, e.Source} }
+
+// Port16 addresses an application with 16-bit port numbers
+type Port16 struct {
+	Destination, Source uint16
+}
+
+// Identifier implements InformationElement
+func (e Port16) Identifier() byte { return IEIPort16 }
+
+// Value implements InformationElement
+func (e Port16) Value() []byte {
+	return []byte{byte(e.Destination >> 8), byte(e.Destination), byte(e.Source >> 8), byte(e.Source)}
+}
+
+// IndicationType is the kind of message waiting in a SpecialMessageIndication
+type IndicationType byte
+
+const (
+	IndicationVoicemail IndicationType = 0
+	IndicationFax       IndicationType = 1
+	IndicationEmail     IndicationType = 2
+	IndicationOther     IndicationType = 3
+)
+
+// SpecialMessageIndication tells the phone how many messages are waiting,
+// like voicemail. A Count of 0 clears the indication.
+type SpecialMessageIndication struct {
+	Type IndicationType
+	// Store is set if the message should be stored by the phone
+	Store bool
+	Count byte
+}
+
+// Identifier implements InformationElement
+func (e SpecialMessageIndication) Identifier() byte { return IEISpecialMessageIndication }
+
+// Value implements InformationElement
+func (e SpecialMessageIndication) Value() []byte {
+	b := byte(e.Type) & 0x7F
+	if e.Store {
+		b |= 0x80
+	}
+	return []byte{b, e.Count}
+}
+
+// RawElement is an information element of any type
+type RawElement struct {
+	ID   byte
+	Data []byte
+}
+
+// Identifier implements InformationElement
+func (e RawElement) Identifier() byte { return e.ID }
+
+// Value implements InformationElement
+func (e RawElement) Value() []byte { return e.Data }
@@ -0,0 +1,78 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&UDHSuite{})
+
+type UDHSuite struct{}
+
+// -------------------------------------------------------------
+// Serialization
+
+func (suite *UDHSuite) Test_UDH_Bytes(c *C) {
+	tests := []struct {
+		udh   UDH
+		bytes []byte
+	}{
+		{nil, nil},
+		{UDH{Concat8{Reference: 0x42, Total: 3, Sequence: 1}}, []byte{0x05, 0x00, 0x03, 0x42, 0x03, 0x01}},
+		{UDH{Concat16{Reference: 0x1234, Total: 2, Sequence: 2}}, []byte{0x06, 0x08, 0x04, 0x12, 0x34, 0x02, 0x02}},
+		{UDH{Port8{Destination: 0xF5, Source: 0x00}}, []byte{0x04, 0x04, 0x02, 0xF5, 0x00}},
+		{UDH{Port16{Destination: PortWAPPush, Source: PortWAPConnectionless}}, []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0}},
+		{UDH{SpecialMessageIndication{Type: IndicationVoicemail, Store: true, Count: 4}}, []byte{0x04, 0x01, 0x02, 0x80, 0x04}},
+		{UDH{RawElement{ID: 0x24, Data: []byte{0x01}}}, []byte{0x03, 0x24, 0x01, 0x01}},
+		{
+			UDH{Port16{Destination: PortVCard, Source: 0}, Concat8{Reference: 1, Total: 2, Sequence: 1}},
+			[]byte{0x0B, 0x05, 0x04, 0x23, 0xF4, 0x00, 0x00, 0x00, 0x03, 0x01, 0x02, 0x01},
+		},
+	}
+
+	for _, test := range tests {
+		c.Check(test.udh.Bytes(), DeepEquals, test.bytes, Commentf("%#v", test.udh))
+
+		parsed, err := ParseUDH(test.bytes)
+		c.Check(err, IsNil)
+		c.Check(parsed, DeepEquals, test.udh)
+	}
+}
+
+// -------------------------------------------------------------
+// Parsing
+
+func (suite *UDHSuite) Test_ParseUDH_UnexpectedLength(c *C) {
+	// a concatenation element with a missing octet is kept as it is
+	udh, err := ParseUDH([]byte{0x04, 0x00, 0x02, 0x01, 0x02})
+	c.Assert(err, IsNil)
+	c.Assert(udh, DeepEquals, UDH{RawElement{ID: 0x00, Data: []byte{0x01, 0x02}}})
+}
+
+func (suite *UDHSuite) Test_ParseUDH_Invalid(c *C) {
+	_, err := ParseUDH([]byte{0x06, 0x00, 0x03})
+	c.Assert(errors.Is(err, ErrInvalidParameter), Equals, true)
+
+	_, err = ParseUDH([]byte{0x03, 0x00, 0x03, 0x01})
+	c.Assert(err, ErrorMatches, "invalid parameter: udh information element 0x00 is truncated")
+	c.Assert(errors.Is(err, ErrInvalidParameter), Equals, true)
+
+	_, err = ParseUDH([]byte{0x01, 0x00})
+	c.Assert(errors.Is(err, ErrInvalidParameter), Equals, true)
+}
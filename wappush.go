@@ -0,0 +1,242 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SIAction is the priority of a service indication
+type SIAction string
+
+const (
+	SIActionSignalNone   SIAction = "signal-none"
+	SIActionSignalLow    SIAction = "signal-low"
+	SIActionSignalMedium SIAction = "signal-medium"
+	SIActionSignalHigh   SIAction = "signal-high"
+	// SIActionDelete removes the indication with the same ID from the phone
+	SIActionDelete SIAction = "delete"
+)
+
+// WBXML tokens of the service indication, see WAP-167-ServiceInd
+var (
+	siHeader = []byte{
+		0x02, // WBXML version 1.2
+		0x05, // public identifier, SI 1.0
+		0x6A, // charset, UTF-8
+		0x00, // string table length
+	}
+
+	siActionTokens = map[SIAction]byte{
+		SIActionSignalNone:   0x05,
+		SIActionSignalLow:    0x06,
+		SIActionSignalMedium: 0x07,
+		SIActionSignalHigh:   0x08,
+		SIActionDelete:       0x09,
+	}
+
+	// siHrefTokens are the href attribute start tokens, longest prefix first
+	siHrefTokens = []struct {
+		prefix string
+		token  byte
+	}{
+		{"https://www.", 0x0F},
+		{"https://", 0x0E},
+		{"http://www.", 0x0D},
+		{"http://", 0x0C},
+		{"", 0x0B},
+	}
+)
+
+const (
+	wbxmlEnd    = 0x01
+	wbxmlStrI   = 0x03
+	wbxmlOpaque = 0xC3
+
+	siTagSI         = 0x45 // si, with content
+	siTagIndication = 0x06 // indication, attributes and content flags are added
+
+	siAttrCreated   = 0x0A
+	siAttrSIExpires = 0x10
+	siAttrSIID      = 0x11
+)
+
+// wspPushHeader is the WSP header of a connectionless push with content
+// type application/vnd.wap.sic
+var wspPushHeader = []byte{
+	0x01, // transaction id
+	0x06, // PDU type, push
+	0x01, // headers length
+	0xAE, // content type, application/vnd.wap.sic
+}
+
+// WAPPushMessage sends a WAP push service indication, a link shown by the
+// phone with a title. It is encoded as a binary message and split into
+// several parts if needed.
+type WAPPushMessage struct {
+	// Required
+	URL string
+
+	// Optional
+	Title string
+	// Action is the priority of the indication, signal-medium if empty
+	Action SIAction
+	// ID identifies the indication, an indication with the same ID replaces it
+	ID string
+	// Created is used by the phone to tell if an indication is out of date
+	Created time.Time
+	// Expires is when the phone removes the indication
+	Expires time.Time
+
+	*Destination
+	*Options
+}
+
+// Type returns the message type
+func (m *WAPPushMessage) Type() string { return "wappush" }
+
+// GetParameters implements Message interface
+func (m *WAPPushMessage) GetParameters() map[string]string {
+	b, err := m.binaryMessage()
+	if err != nil {
+		params := mergeParams(map[string]string{"type": "binary"}, m.Destination.GetParameters())
+		return clearEmpty(mergeParams(params, m.Options.GetParameters()))
+	}
+	return b.GetParameters()
+}
+
+// Segments implements Segmenter
+func (m *WAPPushMessage) Segments() SegmentInfo {
+	b, err := m.binaryMessage()
+	if err != nil {
+		return SegmentInfo{Encoding: EncodingBinary}
+	}
+	return b.Segments()
+}
+
+// Split returns the binary parts the message is sent as
+func (m *WAPPushMessage) Split() ([]*BinaryMessage, error) {
+	b, err := m.binaryMessage()
+	if err != nil {
+		return nil, err
+	}
+	return b.Split()
+}
+
+func (m *WAPPushMessage) parts() ([]Message, error) {
+	b, err := m.binaryMessage()
+	if err != nil {
+		return nil, err
+	}
+	return b.parts()
+}
+
+// binaryMessage returns the service indication as a binary message addressed
+// to the WAP push port
+func (m *WAPPushMessage) binaryMessage() (*BinaryMessage, error) {
+	si, err := m.serviceIndication()
+	if err != nil {
+		return nil, err
+	}
+
+	return &BinaryMessage{
+		UDH:         UDH{Port16{Destination: PortWAPPush, Source: PortWAPConnectionless}}.Bytes(),
+		Binary:      append(append([]byte(nil), wspPushHeader...), si...),
+		Destination: m.Destination,
+		Options:     m.Options,
+	}, nil
+}
+
+// serviceIndication returns the WBXML encoded service indication
+func (m *WAPPushMessage) serviceIndication() ([]byte, error) {
+	if m.URL == "" {
+		return nil, fmt.Errorf("%w: wap push needs a url", ErrInvalidParameter)
+	}
+
+	b := append([]byte(nil), siHeader...)
+	b = append(b, siTagSI)
+
+	indication := byte(siTagIndication | 0x80)
+	if m.Title != "" {
+		indication |= 0x40
+	}
+	b = append(b, indication)
+
+	for _, h := range siHrefTokens {
+		if strings.HasPrefix(m.URL, h.prefix) {
+			b = append(b, h.token)
+			if rest := strings.TrimPrefix(m.URL, h.prefix); rest != "" {
+				b = wbxmlString(b, rest)
+			}
+			break
+		}
+	}
+
+	if m.ID != "" {
+		b = append(b, siAttrSIID)
+		b = wbxmlString(b, m.ID)
+	}
+	if !m.Created.IsZero() {
+		b = append(b, siAttrCreated)
+		b = wbxmlDate(b, m.Created)
+	}
+	if !m.Expires.IsZero() {
+		b = append(b, siAttrSIExpires)
+		b = wbxmlDate(b, m.Expires)
+	}
+	if m.Action != "" {
+		token, ok := siActionTokens[m.Action]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown wap push action %q", ErrInvalidParameter, m.Action)
+		}
+		b = append(b, token)
+	}
+	b = append(b, wbxmlEnd)
+
+	if m.Title != "" {
+		b = wbxmlString(b, m.Title)
+		b = append(b, wbxmlEnd)
+	}
+
+	return append(b, wbxmlEnd), nil
+}
+
+// wbxmlString appends an inline, null terminated string
+func wbxmlString(b []byte, s string) []byte {
+	b = append(b, wbxmlStrI)
+	b = append(b, s...)
+	return append(b, 0x00)
+}
+
+// wbxmlDate appends a date as opaque data, the UTC time as BCD encoded
+// YYYYMMDDhhmmss without trailing zero octets
+func wbxmlDate(b []byte, t time.Time) []byte {
+	t = t.UTC()
+	digits := []int{t.Year() / 100, t.Year() % 100, int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second()}
+
+	date := make([]byte, len(digits))
+	for i, d := range digits {
+		date[i] = byte(d/10<<4 | d%10)
+	}
+	for len(date) > 0 && date[len(date)-1] == 0 {
+		date = date[:len(date)-1]
+	}
+
+	b = append(b, wbxmlOpaque, byte(len(date)))
+	return append(b, date...)
+}
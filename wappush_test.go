@@ -0,0 +1,205 @@
+// Copyright (C) 2016 Great Beyond AB - All Rights Reserved
+// Written by David Högborg <d@greatbeyond.se>, 2016
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cellsynt
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	t "github.com/greatbeyond/cellsynt/testing"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&WAPPushSuite{})
+
+type WAPPushSuite struct{}
+
+// -------------------------------------------------------------
+// Service indication
+
+func (suite *WAPPushSuite) Test_WAPPushMessage_serviceIndication(c *C) {
+	r := &WAPPushMessage{
+		URL:   "http://www.example.com/offer",
+		Title: "Sale",
+	}
+
+	si, err := r.serviceIndication()
+	c.Assert(err, IsNil)
+
+	expected := []byte{0x02, 0x05, 0x6A, 0x00, 0x45, 0xC6, 0x0D, 0x03}
+	expected = append(expected, "example.com/offer"...)
+	expected = append(expected, 0x00, 0x01, 0x03)
+	expected = append(expected, "Sale"...)
+	expected = append(expected, 0x00, 0x01, 0x01)
+	c.Assert(si, DeepEquals, expected)
+}
+
+func (suite *WAPPushSuite) Test_WAPPushMessage_serviceIndication_Attributes(c *C) {
+	r := &WAPPushMessage{
+		URL:     "https://a.se",
+		ID:      "1",
+		Created: time.Date(2026, 10, 16, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Expires: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		Action:  SIActionSignalHigh,
+	}
+
+	si, err := r.serviceIndication()
+	c.Assert(err, IsNil)
+
+	expected := []byte{0x02, 0x05, 0x6A, 0x00, 0x45, 0x86, 0x0E, 0x03}
+	expected = append(expected, "a.se"...)
+	expected = append(expected, 0x00, 0x11, 0x03, '1', 0x00)
+	expected = append(expected, 0x0A, 0xC3, 0x06, 0x20, 0x26, 0x10, 0x16, 0x12, 0x30)
+	expected = append(expected, 0x10, 0xC3, 0x04, 0x20, 0x26, 0x10, 0x17)
+	expected = append(expected, 0x08, 0x01, 0x01)
+	c.Assert(si, DeepEquals, expected)
+}
+
+func (suite *WAPPushSuite) Test_WAPPushMessage_serviceIndication_Invalid(c *C) {
+	_, err := (&WAPPushMessage{Title: "test"}).serviceIndication()
+	c.Assert(errors.Is(err, ErrInvalidParameter), Equals, true)
+
+	_, err = (&WAPPushMessage{URL: "http://a.se", Action: "loud"}).serviceIndication()
+	c.Assert(err, ErrorMatches, `invalid parameter: unknown wap push action "loud"`)
+}
+
+// -------------------------------------------------------------
+// Binary encoding
+
+func (suite *WAPPushSuite) Test_WAPPushMessage_binaryMessage(c *C) {
+	r := &WAPPushMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		URL:   "http://a.se",
+		Title: "test",
+	}
+
+	b, err := r.binaryMessage()
+	c.Assert(err, IsNil)
+	c.Assert(b.UDH, DeepEquals, []byte{0x06, 0x05, 0x04, 0x0B, 0x84, 0x23, 0xF0})
+	c.Assert(bytes.HasPrefix(b.Binary, []byte{0x01, 0x06, 0x01, 0xAE, 0x02, 0x05, 0x6A, 0x00}), Equals, true)
+	c.Assert(b.Destination, Equals, r.Destination)
+
+	params := r.GetParameters()
+	c.Assert(params["type"], Equals, "binary")
+	c.Assert(params["udh"], Equals, "0605040B8423F0")
+	c.Assert(strings.HasPrefix(params["data"], "010601AE02056A0045C60C03"), Equals, true)
+}
+
+func (suite *WAPPushSuite) Test_WAPPushMessage_Split(c *C) {
+	r := &WAPPushMessage{
+		URL:   "http://www.example.com/" + strings.Repeat("a", 150),
+		Title: "test",
+	}
+	c.Assert(r.Segments().Segments, Equals, 2)
+
+	parts, err := r.Split()
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 2)
+	for i, part := range parts {
+		udh, err := ParseUDH(part.UDH)
+		c.Assert(err, IsNil)
+		c.Assert(udh, HasLen, 2)
+		c.Assert(udh[0], Equals, InformationElement(Port16{Destination: PortWAPPush, Source: PortWAPConnectionless}))
+		c.Assert(udh[1].(Concat8).Sequence, Equals, byte(i+1))
+	}
+}
+
+func (suite *WAPPushSuite) Test_WAPPushMessage_Outbox(c *C) {
+	r := &WAPPushMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		URL:    "http://a.se",
+		Action: SIActionDelete,
+		ID:     "offer-1",
+	}
+
+	data, err := encodeMessage(r)
+	c.Assert(err, IsNil)
+
+	decoded, err := decodeMessage(r.Type(), data)
+	c.Assert(err, IsNil)
+	c.Assert(decoded, DeepEquals, Message(r))
+
+	moved, err := withDestination(r, &Destination{Recipients: []string{"0046703445566"}})
+	c.Assert(err, IsNil)
+	c.Assert(moved.Destinations(), Equals, "0046703445566")
+	c.Assert(r.Destinations(), Equals, "0046703112233")
+}
+
+// -------------------------------------------------------------
+// Client
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_WAPPush(c *C) {
+	r := &WAPPushMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		URL:   "http://a.se",
+		Title: "test",
+	}
+
+	suite.server.AddResponse(&t.MockResponse{
+		Method: "POST",
+		Code:   200,
+		Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+		CheckFn: func(r *http.Request, body string) {
+			values, err := url.ParseQuery(body)
+			c.Assert(err, IsNil)
+			c.Assert(values.Get("type"), Equals, "binary")
+			c.Assert(values.Get("udh"), Equals, "0605040B8423F0")
+			c.Assert(values.Get("data"), Equals, "010601AE02056A0045C60C03612E736500010374657374000101")
+		},
+	})
+
+	response, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+	c.Assert(response.TrackingIDs, DeepEquals, []string{"de8c4a032fb45ae65ab9e349a8dc2458"})
+}
+
+func (suite *CellsyntSuite) Test_Client_SendMessage_WAPPushMultipart(c *C) {
+	r := &WAPPushMessage{
+		Destination: &Destination{
+			Recipients: []string{"0046703112233"},
+		},
+		URL:   "http://www.example.com/" + strings.Repeat("a", 150),
+		Title: "test",
+	}
+
+	for _, part := range []string{"01", "02"} {
+		part := part
+		suite.server.AddResponse(&t.MockResponse{
+			Method: "POST",
+			Code:   200,
+			Body:   "OK: de8c4a032fb45ae65ab9e349a8dc2458",
+			CheckFn: func(r *http.Request, body string) {
+				values, err := url.ParseQuery(body)
+				c.Assert(err, IsNil)
+				c.Assert(values.Get("udh"), Matches, "0B05040B8423F00003[0-9A-F]{2}02"+part)
+			},
+		})
+	}
+
+	response, err := suite.client.SendMessage(r)
+	c.Assert(err, IsNil)
+	c.Assert(response.TrackingIDs, HasLen, 2)
+}